@@ -0,0 +1,114 @@
+// +build linux
+
+package ss
+
+import (
+	"context"
+	"fmt"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice/internal/bus"
+)
+
+const (
+	_NameHasOwner       = "org.freedesktop.DBus.NameHasOwner"
+	_StartServiceByName = "org.freedesktop.DBus.StartServiceByName"
+	_ListActivatable    = "org.freedesktop.DBus.ListActivatableNames"
+)
+
+// ErrServiceUnavailable is returned when nothing provides the service, and
+// nothing could be started to. It's also a ServiceUnknown.
+var ErrServiceUnavailable error = &kind{"secret service unavailable", ServiceUnknown}
+
+// Available reports whether anything owns c's bus name.
+func (c *Client) Available(ctx context.Context) (bool, error) {
+	var ok bool
+	err := call(ctx, c.conn.BusObject(), _NameHasOwner, c.name).Store(&ok)
+	return ok, err
+}
+
+// activatable reports whether the bus can start a provider of c's bus name.
+func (c *Client) activatable(ctx context.Context) (bool, error) {
+	var names []string
+	if err := call(ctx, c.conn.BusObject(), _ListActivatable).Store(&names); err != nil {
+		return false, err
+	}
+	for _, n := range names {
+		if n == c.name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Activate asks the bus to start the provider of c's bus name, if nothing
+// owns it yet, and waits until something does or ctx is done. It returns
+// ErrServiceUnavailable if the bus has no way of starting one.
+func (c *Client) Activate(ctx context.Context) error {
+	// Subscribed first, so the owner can't appear unnoticed.
+	sub, err := bus.For(c.conn).Subscribe(bus.Match{
+		Sender: _DBusName,
+		Path:   _DBusPath,
+		Iface:  _DBusName,
+		Member: nameOwnerEvent,
+		Arg0:   c.name,
+	})
+	if err != nil {
+		return err
+	}
+	defer sub.Cancel()
+	if ok, err := c.Available(ctx); err != nil || ok {
+		return err
+	}
+	var reply uint32
+	if err := call(ctx, c.conn.BusObject(), _StartServiceByName, c.name, uint32(0)).Store(&reply); err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrServiceUnavailable, err)
+	}
+	// The bus usually answers once the name is taken, but a provider
+	// started by, say, systemd may not have it yet.
+	for {
+		if ok, err := c.Available(ctx); err != nil || ok {
+			return err
+		}
+		select {
+		case _, ok := <-sub.C:
+			if !ok {
+				return ServiceGone
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// DialServiceContext is DialService with a context. With activate set, a
+// provider is started through D-Bus activation right away if need be,
+// waiting for it until ctx is done.
+func DialServiceContext(ctx context.Context, activate bool) (Service, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return Service{}, err
+	}
+	c, err := NewClient(conn, ServiceName)
+	if err != nil {
+		return Service{}, err
+	}
+	if activate {
+		err = c.Activate(ctx)
+	} else {
+		var ok bool
+		if ok, err = c.Available(ctx); err == nil && !ok {
+			// The bus starts it on the first call.
+			if ok, err = c.activatable(ctx); err == nil && !ok {
+				err = ErrServiceUnavailable
+			}
+		}
+	}
+	if err != nil {
+		return Service{}, err
+	}
+	return c.Service(), nil
+}
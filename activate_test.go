@@ -0,0 +1,52 @@
+package ss
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAvailable(t *testing.T) {
+	c := selfClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if ok, err := c.Available(ctx); !ok || err != nil {
+		t.Errorf("own name: got %v, %v", ok, err)
+	}
+	if err := c.Activate(ctx); err != nil {
+		t.Errorf("Activate on own name: %v", err)
+	}
+
+	nobody, err := NewClient(c.Conn(), "org.example.nobody.home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := nobody.Available(ctx); ok || err != nil {
+		t.Errorf("unowned name: got %v, %v", ok, err)
+	}
+	if ok, err := nobody.activatable(ctx); ok || err != nil {
+		t.Errorf("activatable: got %v, %v", ok, err)
+	}
+	err = nobody.Activate(ctx)
+	if !errors.Is(err, ErrServiceUnavailable) || !errors.Is(err, ServiceUnknown) {
+		t.Errorf("Activate on unowned name: got %v", err)
+	}
+}
+
+func TestDialServiceContext(t *testing.T) {
+	c := selfClient(t)
+	s, err := NewClient(c.Conn(), ServiceName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.Available(context.Background()); ok {
+		t.Skip("a secret service is running")
+	}
+	if ok, _ := s.activatable(context.Background()); ok {
+		t.Skip("a secret service can be activated")
+	}
+	if _, err := DialServiceContext(context.Background(), false); !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("got %v, want ErrServiceUnavailable", err)
+	}
+}
@@ -0,0 +1,73 @@
+// +build linux
+
+package ss
+
+import (
+	"fmt"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+// Client is the connection and bus name a Service lives at. Every
+// Collection, Item, Session and Prompt derived from a Service reuses its
+// Client, so they all talk to the same provider over the same connection.
+type Client struct {
+	// Decides how prompts are handled; see AlwaysPrompt for the default.
+	// Set it before the Client is used.
+	Prompter Prompter
+	// Decides whether sessions may be plain; see SessionPolicy. Set it
+	// before the Client is used.
+	SessionPolicy SessionPolicy
+
+	conn *dbus.Conn
+	name string
+}
+
+// NewClient returns a Client for the provider owning busName on conn. An
+// empty busName means ServiceName.
+func NewClient(conn *dbus.Conn, busName string) (*Client, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("nil connection")
+	}
+	if busName == "" {
+		busName = ServiceName
+	}
+	return &Client{conn: conn, name: busName}, nil
+}
+
+// Conn returns the connection c was built with.
+func (c *Client) Conn() *dbus.Conn {
+	return c.conn
+}
+
+// BusName returns the bus name c sends calls to.
+func (c *Client) BusName() string {
+	return c.name
+}
+
+// Service returns the Service object of c's provider.
+func (c *Client) Service() Service {
+	return Service{c.object(ServicePath), c}
+}
+
+// Collection returns the Collection at path.
+func (c *Client) Collection(path dbus.ObjectPath) Collection {
+	return Collection{c.object(path), c}
+}
+
+// Item returns the Item at path.
+func (c *Client) Item(path dbus.ObjectPath) Item {
+	return Item{c.object(path), c}
+}
+
+func (c *Client) object(path dbus.ObjectPath) *dbus.Object {
+	return c.conn.Object(c.name, path)
+}
+
+func (c *Client) prompt(path dbus.ObjectPath) Prompt {
+	return Prompt{c.object(path), c}
+}
+
+func (c *Client) session(path dbus.ObjectPath, algo string, key []byte) Session {
+	return Session{c.object(path), algo, key, c}
+}
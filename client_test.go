@@ -0,0 +1,33 @@
+package ss
+
+import (
+	"testing"
+)
+
+func TestNewClient(t *testing.T) {
+	if _, err := NewClient(nil, ServiceName); err == nil {
+		t.Error("nil connection accepted")
+	}
+	conn := getConn()
+	if conn == nil {
+		t.Skip("no session bus")
+	}
+	const name = "org.example.test.secrets"
+	srv, err := DialServiceWithConn(conn, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := srv.Client()
+	if c.Conn() != conn || c.BusName() != name {
+		t.Errorf("client has %p/%q, want %p/%q", c.Conn(), c.BusName(), conn, name)
+	}
+	for _, o := range []interface {
+		Destination() string
+	}{
+		srv, c.Collection(DefaultCollection), c.Item(DefaultCollection + "/1"),
+	} {
+		if o.Destination() != name {
+			t.Errorf("%T sends to %q, want %q", o, o.Destination(), name)
+		}
+	}
+}
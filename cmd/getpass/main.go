@@ -1,71 +1,249 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"unicode/utf8"
 
 	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/gnomekeyring"
 )
 
 var (
-	plain   = flag.Bool("p", false, "use plain transport instead of encrypted transport")
-	newline = flag.Bool("n", false, "append a newline to output")
-	l       = log.New(os.Stderr, "getpass\t", log.Ltime)
+	plain      = flag.Bool("p", false, "allow plain transport if the service can't do encrypted transport")
+	newline    = flag.Bool("n", false, "append a newline to output")
+	binary     = flag.Bool("b", false, "write secrets that aren't text to a terminal too")
+	file       = flag.String("f", "", "read a gnome-keyring `file` instead of asking the daemon")
+	collection = flag.String("c", "", "only look in the `collection` with this alias or object path")
+	noPrompt   = flag.Bool("no-prompt", false, "fail rather than prompt to unlock a locked item")
+	relock     = flag.Bool("relock", false, "lock the item again after reading it, if it was locked")
+	first      = flag.Bool("first", false, "if several items match, print the first one listed")
+	all        = flag.Bool("all", false, "if several items match, print all of them, a line each")
+	index      = flag.Int("index", 0, "if several items match, print the `n`th one listed, counting from 1")
+	l          = log.New(os.Stderr, "getpass\t", log.Ltime)
 )
 
 func init() {
 	flag.Usage = func() {
-		fmt.Println(`getpass [-p] NAME
+		fmt.Print(`getpass [-p] [-n] [-b] [-c COLLECTION] [-no-prompt] [-relock]
+        [-first | -all | -index N] [NAME] [KEY=VALUE...]
+getpass -f FILE [-first | -all | -index N] [NAME] [KEY=VALUE...]
 
 Prints secret "NAME" string-ified.
+
+Items can be looked up by label, by attributes, or both: "getpass
+service=github user=ci" prints the secret of the item having both of
+those attributes. Attribute lookups are done by the service, so they're
+much quicker than going through every item's label.
+
+If more than one item matches, getpass lists them, ordered by object path,
+and fails, unless -first, -all or -index says which to print.
+
+Locked items are unlocked, which usually means the service asks for the
+keyring's password. With -no-prompt, getpass fails instead, for scripts
+nobody is watching. With -relock, the item is locked again afterwards.
+
+Secrets that aren't text, going by their content type, aren't written to
+a terminal unless -b is given.
+
+The secret is fetched over an encrypted session. With -p, getpass falls
+back to a plain one, with a warning, if the service can't encrypt.
+
+With -f, the secret is read from a gnome-keyring file, such as
+~/.local/share/keyrings/login.keyring. The keyring password is asked for
+on the terminal, or read from the first line of stdin.
+
+Exit codes:
+	0  the secret was printed
+	1  any other error
+	2  bad arguments
+	3  no item matches, or -index is past the last match
+	4  the item is locked and wasn't unlocked, or the password was wrong
+	5  more than one item matches
+	6  the secret service isn't available
 `)
 		flag.PrintDefaults()
 		fmt.Println()
 	}
-	flag.Parse()
 }
 
 func main() {
-	algorithm := ss.AlgoDH
-	if *plain {
-		algorithm = ss.AlgoPlain
+	flag.Parse()
+	if err := ss.DisableCoreDumps(); err != nil {
+		l.Printf("warning: can't disable core dumps: %v\n", err)
+	}
+	q, err := parseQuery(flag.Args())
+	if err == nil {
+		err = checkChoice()
+	}
+	if err != nil {
+		l.Printf("%v\n", err)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+	if *file != "" {
+		readFile(*file, q)
+		os.Exit(0)
 	}
 
 	srv, err := ss.DialService()
 	if err != nil {
-		l.Fatalf("DialService error: %v\n", err)
+		fail(exitUnavailable, "DialService error: %v\n", err)
+	}
+	if *plain {
+		srv.Client().SessionPolicy = ss.AllowPlain
 	}
 
-	session, err := srv.OpenSession(algorithm)
+	session, err := srv.NegotiateSession()
 	if err != nil {
-		l.Fatalf("OpenSession error: %v\n", err)
-	}
-
-	for _, c := range srv.Collections() {
-		for _, i := range c.Items() {
-			if i.GetLabel() == flag.Arg(0) {
-				if i.Locked() {
-					// TODO: unlock
-					l.Fatalf("item '%s' locked\n", i.GetLabel())
-				}
-				s, err := i.GetSecret(session)
-				if err != nil {
-					l.Fatalf("GetSecret error: %v\n", err)
-				}
-				pass, err := s.GetValue(session)
-				if err != nil {
-					l.Fatalf("Open error: %v\n", err)
-				}
-				fmt.Printf("%v", string(pass))
-				if *newline {
-					fmt.Printf("\n")
-				}
-				goto Leave
-			}
+		fail(exitCode(err), "NegotiateSession error: %v\n", err)
+	}
+	if session.Algorithm == ss.AlgoPlain {
+		l.Printf("warning: the secret is sent over the bus unencrypted\n")
+	}
+
+	found, err := q.search(srv, *collection)
+	if err != nil {
+		fail(exitCode(err), "search error: %v\n", err)
+	}
+	if len(found) == 0 {
+		fail(exitNotFound, "no item matches %v\n", q)
+	}
+	var items []ss.Item
+	for _, n := range pick(q, len(found), func(n int) match { return describe(found[n]) }) {
+		items = append(items, found[n])
+	}
+
+	var locked []ss.Object
+	for _, i := range items {
+		isLocked, err := i.Locked()
+		if err != nil {
+			fail(exitCode(err), "Locked error: %v\n", err)
+		}
+		if isLocked {
+			locked = append(locked, i)
 		}
 	}
-Leave:
+	if len(locked) > 0 {
+		if *noPrompt {
+			srv.Client().Prompter = ss.NeverPrompt{}
+		}
+		unlocked, err := srv.Unlock(locked)
+		switch {
+		case errors.Is(err, ss.PromptRequired):
+			fail(exitLocked, "item %s locked, and unlocking it needs a prompt\n", locked[0].Path())
+		case err != nil:
+			fail(exitCode(err), "Unlock error: %v\n", err)
+		case len(unlocked) < len(locked):
+			fail(exitLocked, "item %s not unlocked\n", locked[0].Path())
+		}
+	}
+	for _, i := range items {
+		s, err := i.GetSecret(session)
+		if err != nil {
+			fail(exitCode(err), "GetSecret error: %v\n", err)
+		}
+		pass, err := s.GetValueBuffer(session)
+		if err != nil {
+			l.Fatalf("Open error: %v\n", err)
+		}
+		output(pass.Bytes(), s.IsText())
+		pass.Destroy()
+	}
+	if len(locked) > 0 && *relock {
+		if _, err := srv.Lock(locked); err != nil {
+			l.Fatalf("Lock error: %v\n", err)
+		}
+	}
+	session.Close()
 	os.Exit(0)
 }
+
+// checkChoice makes sure at most one of -first, -all and -index is given.
+func checkChoice() error {
+	n := 0
+	for _, set := range []bool{*first, *all, *index != 0} {
+		if set {
+			n++
+		}
+	}
+	switch {
+	case *index < 0:
+		return fmt.Errorf("-index counts from 1")
+	case n > 1:
+		return fmt.Errorf("-first, -all and -index don't go together")
+	}
+	return nil
+}
+
+// describe is best effort: it's only used when things have already gone
+// wrong.
+func describe(i ss.Item) match {
+	m := match{path: string(i.Path())}
+	m.label, _ = i.GetLabel()
+	m.attrs, _ = i.GetAttributes()
+	return m
+}
+
+// output writes secret as is: converting it to a string would leave a copy
+// on the heap. Binary secrets only go to a terminal with -b.
+func output(secret []byte, text bool) {
+	if !text && !*binary && isTerminal(os.Stdout.Fd()) {
+		l.Fatalf("not writing a binary secret to a terminal; use -b to anyway\n")
+	}
+	os.Stdout.Write(secret)
+	if *newline || *all {
+		fmt.Printf("\n")
+	}
+}
+
+// readFile prints the secrets of the items matching q in a keyring file.
+// The password is only asked for if the file turns out to be encrypted.
+func readFile(path string, q query) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		l.Fatalf("ReadFile error: %v\n", err)
+	}
+	k, err := gnomekeyring.Parse(b, nil)
+	if errors.Is(err, gnomekeyring.BadPassword) {
+		var pass *ss.Buffer
+		pass, err = readPassword(fmt.Sprintf("Password for %s: ", path))
+		if err != nil {
+			l.Fatalf("reading password: %v\n", err)
+		}
+		k, err = gnomekeyring.Parse(b, pass.Bytes())
+		pass.Destroy()
+	}
+	switch {
+	case errors.Is(err, gnomekeyring.BadPassword):
+		fail(exitLocked, "%s: %v\n", path, err)
+	case err != nil:
+		l.Fatalf("%s: %v\n", path, err)
+	}
+	defer func() {
+		for _, i := range k.Items {
+			ss.Wipe(i.Secret)
+		}
+	}()
+	var found []gnomekeyring.Item
+	for _, i := range k.Search(q.attrs) {
+		if q.label == "" || i.Label == q.label {
+			found = append(found, i)
+		}
+	}
+	if len(found) == 0 {
+		fail(exitNotFound, "no item in %s matches %v\n", path, q)
+	}
+	describe := func(n int) match {
+		i := found[n]
+		return match{fmt.Sprintf("%s:%d", path, i.ID), i.Label, i.Attributes}
+	}
+	for _, n := range pick(q, len(found), describe) {
+		// Files don't keep content types.
+		output(found[n].Secret, utf8.Valid(found[n].Secret))
+	}
+}
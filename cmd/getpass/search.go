@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+)
+
+// query is what to look for: items with a label, attributes, or both.
+type query struct {
+	label string
+	attrs map[string]string
+}
+
+// parseQuery takes getpass's arguments: key=value pairs are attributes, and
+// a lone word is a label.
+func parseQuery(args []string) (query, error) {
+	q := query{attrs: make(map[string]string)}
+	for _, a := range args {
+		k, v, ok := a, "", false
+		if n := strings.Index(a, "="); n >= 0 {
+			k, v, ok = a[:n], a[n+1:], true
+		}
+		switch {
+		case !ok && q.label != "":
+			return q, fmt.Errorf("more than one label: %q and %q", q.label, a)
+		case !ok:
+			q.label = a
+		case k == "":
+			return q, fmt.Errorf("%q: empty attribute name", a)
+		default:
+			q.attrs[k] = v
+		}
+	}
+	if q.label == "" && len(q.attrs) == 0 {
+		return q, fmt.Errorf("nothing to look for")
+	}
+	return q, nil
+}
+
+func (q query) String() string {
+	var s []string
+	if q.label != "" {
+		s = append(s, fmt.Sprintf("%q", q.label))
+	}
+	keys := make([]string, 0, len(q.attrs))
+	for k := range q.attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s = append(s, k+"="+q.attrs[k])
+	}
+	return strings.Join(s, " ")
+}
+
+// search returns the items matching q, ordered by path. If collection
+// isn't empty, only items in that collection, given by alias or path, are.
+func (q query) search(srv ss.Service, collection string) ([]ss.Item, error) {
+	var coll ss.Collection
+	if collection != "" {
+		var err error
+		if coll, err = findCollection(srv, collection); err != nil {
+			return nil, err
+		}
+	}
+	var items []ss.Item
+	switch {
+	case len(q.attrs) > 0 && collection != "":
+		var err error
+		if items, err = coll.SearchItems(q.attrs); err != nil {
+			return nil, err
+		}
+	case len(q.attrs) > 0:
+		unlocked, locked, err := srv.SearchItems(q.attrs)
+		if err != nil {
+			return nil, err
+		}
+		items = append(unlocked, locked...)
+	default:
+		// Only a label: look at everything.
+		colls := []ss.Collection{coll}
+		if collection == "" {
+			var err error
+			if colls, err = srv.Collections(); err != nil {
+				return nil, err
+			}
+		}
+		for _, c := range colls {
+			i, err := c.Items()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, i...)
+		}
+	}
+
+	var ret []ss.Item
+	for _, i := range items {
+		if q.label != "" {
+			label, err := i.GetLabel()
+			if err != nil {
+				return nil, err
+			}
+			if label != q.label {
+				continue
+			}
+		}
+		ret = append(ret, i)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path() < ret[j].Path() })
+	return ret, nil
+}
+
+// findCollection takes an object path or an alias.
+func findCollection(srv ss.Service, name string) (ss.Collection, error) {
+	if strings.HasPrefix(name, "/") {
+		return srv.Client().Collection(dbus.ObjectPath(name)), nil
+	}
+	c, err := srv.ReadAlias(name)
+	if err != nil {
+		return ss.Collection{}, err
+	}
+	if c.Path() == "/" {
+		return ss.Collection{}, fmt.Errorf("no collection with alias %q", name)
+	}
+	return c, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		want query
+		str  string
+	}{
+		{[]string{"github"}, query{label: "github", attrs: map[string]string{}}, `"github"`},
+		{
+			[]string{"user=ci", "service=github"},
+			query{attrs: map[string]string{"service": "github", "user": "ci"}},
+			"service=github user=ci",
+		},
+		{
+			[]string{"token", "url=https://x/?a=b", "empty="},
+			query{label: "token", attrs: map[string]string{"url": "https://x/?a=b", "empty": ""}},
+			`"token" empty= url=https://x/?a=b`,
+		},
+	} {
+		q, err := parseQuery(c.args)
+		if err != nil {
+			t.Errorf("%q: %v", c.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(q, c.want) {
+			t.Errorf("%q: got %+v, want %+v", c.args, q, c.want)
+		}
+		if q.String() != c.str {
+			t.Errorf("%q: got %s, want %s", c.args, q, c.str)
+		}
+	}
+	for _, args := range [][]string{nil, {"a", "b"}, {"=x"}} {
+		if _, err := parseQuery(args); err == nil {
+			t.Errorf("%q: accepted", args)
+		}
+	}
+}
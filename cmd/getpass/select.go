@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hdonnay/secretservice"
+)
+
+// Exit codes, so scripts can tell a miss from a failure. Anything else
+// exits 1.
+const (
+	exitUsage       = 2
+	exitNotFound    = 3
+	exitLocked      = 4 // locked, and unlocking was refused or failed
+	exitAmbiguous   = 5
+	exitUnavailable = 6
+)
+
+// fail logs and exits with code.
+func fail(code int, format string, v ...interface{}) {
+	l.Printf(format, v...)
+	os.Exit(code)
+}
+
+// exitCode picks the exit code for an error from the service.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ss.ServiceGone):
+		return exitUnavailable
+	case errors.Is(err, ss.IsLocked),
+		errors.Is(err, ss.PromptDismissed),
+		errors.Is(err, ss.PromptRequired):
+		return exitLocked
+	case errors.Is(err, ss.NoSuchObject), errors.Is(err, ss.NotFound):
+		return exitNotFound
+	}
+	return 1
+}
+
+var (
+	errAmbiguous = fmt.Errorf("more than one item matches")
+	errNoIndex   = fmt.Errorf("no item with that index")
+)
+
+// choose returns the indexes of the n matches to print, going by -first,
+// -all and -index. Indexes given to -index count from 1; 0 means unset.
+func choose(n int, first, all bool, index int) ([]int, error) {
+	switch {
+	case all:
+		ret := make([]int, n)
+		for i := range ret {
+			ret[i] = i
+		}
+		return ret, nil
+	case index > n:
+		return nil, errNoIndex
+	case index > 0:
+		return []int{index - 1}, nil
+	case first || n == 1:
+		return []int{0}, nil
+	}
+	return nil, errAmbiguous
+}
+
+// match describes a matching item in error messages.
+type match struct {
+	path  string
+	label string
+	attrs map[string]string
+}
+
+func (m match) String() string {
+	return m.path + " " + query{m.label, m.attrs}.String()
+}
+
+// pick is choose for getpass's flags. If that fails, it exits listing the
+// matches, which describe returns.
+func pick(q query, n int, describe func(int) match) []int {
+	idx, err := choose(n, *first, *all, *index)
+	if err == nil {
+		return idx
+	}
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "\t%d: %v\n", i+1, describe(i))
+	}
+	code := exitAmbiguous
+	if err == errNoIndex {
+		code = exitNotFound
+	}
+	fail(code, "%v: %d items match %v; use -first, -all or -index:\n%s", err, n, q, b.String())
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChoose(t *testing.T) {
+	for _, c := range []struct {
+		n     int
+		first bool
+		all   bool
+		index int
+		want  []int
+		err   error
+	}{
+		{n: 1, want: []int{0}},
+		{n: 3, err: errAmbiguous},
+		{n: 3, first: true, want: []int{0}},
+		{n: 3, all: true, want: []int{0, 1, 2}},
+		{n: 3, index: 3, want: []int{2}},
+		{n: 3, index: 4, err: errNoIndex},
+		{n: 1, index: 2, err: errNoIndex},
+	} {
+		got, err := choose(c.n, c.first, c.all, c.index)
+		if err != c.err || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("choose(%d, %v, %v, %d) = %v, %v; want %v, %v", c.n, c.first, c.all, c.index, got, err, c.want, c.err)
+		}
+	}
+}
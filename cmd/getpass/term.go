@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/hdonnay/secretservice"
+)
+
+// The longest password readPassword takes.
+const maxPassword = 4096
+
+func ioctl(fd uintptr, req uintptr, t *syscall.Termios) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t))); e != 0 {
+		return e
+	}
+	return nil
+}
+
+func isTerminal(fd uintptr) bool {
+	var t syscall.Termios
+	return ioctl(fd, syscall.TCGETS, &t) == nil
+}
+
+// readPassword asks for a password on the terminal with echo turned off,
+// or reads the first line of stdin if it isn't a terminal.
+func readPassword(prompt string) (*ss.Buffer, error) {
+	fd := os.Stdin.Fd()
+	var old syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, &old); err != nil {
+		return readLine(os.Stdin)
+	}
+	t := old
+	t.Lflag &^= syscall.ECHO
+	t.Lflag |= syscall.ICANON | syscall.ECHONL
+	if err := ioctl(fd, syscall.TCSETS, &t); err != nil {
+		return nil, err
+	}
+	defer ioctl(fd, syscall.TCSETS, &old)
+	fmt.Fprint(os.Stderr, prompt)
+	return readLine(os.Stdin)
+}
+
+// readLine reads up to a newline straight into a Buffer, a byte at a time so
+// nothing past the line is consumed and no other copy is made.
+func readLine(f *os.File) (*ss.Buffer, error) {
+	b, err := ss.NewBuffer(maxPassword)
+	if err != nil {
+		return nil, err
+	}
+	buf := b.Bytes()
+	n := 0
+	for ; n < len(buf); n++ {
+		_, err := f.Read(buf[n : n+1])
+		if err == io.EOF && n > 0 {
+			break
+		}
+		if err != nil {
+			b.Destroy()
+			return nil, err
+		}
+		if buf[n] == '\n' {
+			buf[n] = 0
+			break
+		}
+	}
+	if n == len(buf) {
+		b.Destroy()
+		return nil, fmt.Errorf("password longer than %d bytes", maxPassword)
+	}
+	pass, err := ss.NewBuffer(n)
+	if err != nil {
+		b.Destroy()
+		return nil, err
+	}
+	copy(pass.Bytes(), buf[:n])
+	b.Destroy()
+	return pass, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	kdfArgon2id = "argon2id"
+	kdfScrypt   = "scrypt"
+
+	fileVersion = 1
+)
+
+// header is stored in the clear at the top of the file. It's authenticated
+// as the AEAD's additional data, so the KDF parameters can't be swapped.
+type header struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	// argon2id
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+	// scrypt
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	Nonce []byte `json:"nonce"`
+}
+
+type file struct {
+	Header header `json:"header"`
+	Data   []byte `json:"data"`
+}
+
+// newHeader returns a header with a fresh salt and the default parameters
+// for kdf.
+func newHeader(kdf string) (header, error) {
+	h := header{Version: fileVersion, KDF: kdf, Salt: make([]byte, 16)}
+	switch kdf {
+	case kdfArgon2id:
+		h.Time, h.Memory, h.Threads = 3, 64*1024, 4
+	case kdfScrypt:
+		h.N, h.R, h.P = 1<<15, 8, 1
+	default:
+		return h, fmt.Errorf("unknown kdf %q", kdf)
+	}
+	_, err := rand.Read(h.Salt)
+	return h, err
+}
+
+func (h header) key(passphrase []byte) ([]byte, error) {
+	switch h.KDF {
+	case kdfArgon2id:
+		return argon2.IDKey(passphrase, h.Salt, h.Time, h.Memory, h.Threads, chacha20poly1305.KeySize), nil
+	case kdfScrypt:
+		return scrypt.Key(passphrase, h.Salt, h.N, h.R, h.P, chacha20poly1305.KeySize)
+	}
+	return nil, fmt.Errorf("unknown kdf %q", h.KDF)
+}
+
+// seal encrypts plaintext under key with a fresh nonce.
+func seal(h header, key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	h.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(h.Nonce); err != nil {
+		return nil, err
+	}
+	ad, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(file{Header: h, Data: aead.Seal(nil, h.Nonce, plaintext, ad)}, "", "\t")
+}
+
+// open decrypts a file written by seal, returning its header and the key
+// derived from passphrase, for writing it back.
+func open(b, passphrase []byte) (header, []byte, []byte, error) {
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return header{}, nil, nil, err
+	}
+	if f.Header.Version != fileVersion {
+		return header{}, nil, nil, fmt.Errorf("unknown file version %d", f.Header.Version)
+	}
+	key, err := f.Header.key(passphrase)
+	if err != nil {
+		return header{}, nil, nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return header{}, nil, nil, err
+	}
+	if len(f.Header.Nonce) != aead.NonceSize() {
+		return header{}, nil, nil, fmt.Errorf("bad nonce")
+	}
+	ad, err := json.Marshal(f.Header)
+	if err != nil {
+		return header{}, nil, nil, err
+	}
+	plaintext, err := aead.Open(nil, f.Header.Nonce, f.Data, ad)
+	if err != nil {
+		return header{}, nil, nil, fmt.Errorf("wrong passphrase, or the file is damaged")
+	}
+	return f.Header, key, plaintext, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/server"
+)
+
+var (
+	path     = flag.String("f", defaultPath(), "keyring file, created if missing")
+	passFD   = flag.Int("passphrase-fd", 0, "read the passphrase from this file descriptor")
+	kdf      = flag.String("kdf", kdfArgon2id, "key derivation for a new file: argon2id or scrypt")
+	unlock   = flag.String("unlock-command", "", "run this shell `command` to ask for the passphrase when a client unlocks a collection")
+	insecure = flag.Bool("insecure", false, "let any client unlock collections without the passphrase")
+	l        = log.New(os.Stderr, "ssd\t", log.Ltime)
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, `ssd [-f FILE] [-passphrase-fd N] [-kdf argon2id|scrypt]
+    -unlock-command COMMAND | -insecure
+
+Serves org.freedesktop.secrets on the session bus, keeping collections in a
+passphrase-encrypted file. The passphrase is the first line read from the
+file descriptor, stdin by default.
+
+Unlocking a locked collection takes the passphrase again: COMMAND is run
+through /bin/sh, with the objects to unlock in $SSD_UNLOCK, and prints it
+on its first line. Without a command, ssd refuses to start, unless
+-insecure says any process on the bus may unlock collections.`)
+		flag.PrintDefaults()
+	}
+}
+
+func defaultPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	}
+	return filepath.Join(dir, "ssd", "keyring")
+}
+
+// readPassphrase returns the first line read from fd, without the newline.
+func readPassphrase(fd int) ([]byte, error) {
+	f := os.NewFile(uintptr(fd), "passphrase")
+	if f == nil {
+		return nil, fmt.Errorf("bad file descriptor %d", fd)
+	}
+	defer f.Close()
+	b, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	b = bytes.TrimRight(b, "\r\n")
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	return b, nil
+}
+
+func main() {
+	flag.Parse()
+	if *unlock == "" && !*insecure {
+		l.Printf("no -unlock-command; give one, or -insecure to unlock without asking\n")
+		flag.Usage()
+		os.Exit(2)
+	}
+	pass, err := readPassphrase(*passFD)
+	if err != nil {
+		l.Fatalf("passphrase error: %v\n", err)
+	}
+	st, err := openStore(*path, pass, *kdf)
+	for i := range pass {
+		pass[i] = 0
+	}
+	if err != nil {
+		l.Fatalf("open error: %v\n", err)
+	}
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		l.Fatalf("SessionBus error: %v\n", err)
+	}
+	srv, err := server.New(conn, st)
+	if err != nil {
+		l.Fatalf("export error: %v\n", err)
+	}
+	defer srv.Close()
+	if *unlock != "" {
+		srv.Prompter = &commandPrompter{command: *unlock, st: st}
+	}
+	reply, err := conn.RequestName(ss.ServiceName, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		l.Fatalf("RequestName error: %v\n", err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		l.Fatalf("%s is already owned by another service\n", ss.ServiceName)
+	}
+	l.Printf("serving %s from %s\n", ss.ServiceName, *path)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/server"
+)
+
+// commandPrompter asks for the passphrase by running a command, such as a
+// pinentry wrapper, before letting a client unlock anything. The command
+// gets the objects to unlock in $SSD_UNLOCK, and prints the passphrase on
+// its first line.
+type commandPrompter struct {
+	command string
+	st      *store
+}
+
+func (p *commandPrompter) Prompt(ctx context.Context, r server.PromptRequest) bool {
+	if r.Kind != server.PromptUnlock {
+		// Nothing to give away in making a collection.
+		return true
+	}
+	paths := make([]string, len(r.Objects))
+	for i, o := range r.Objects {
+		paths[i] = string(o)
+	}
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", p.command)
+	cmd.Env = append(os.Environ(), "SSD_UNLOCK="+strings.Join(paths, " "))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	defer ss.Wipe(out)
+	if err != nil {
+		l.Printf("unlock command: %v\n", err)
+		return false
+	}
+	line, _ := bufio.NewReader(bytes.NewReader(out)).ReadSlice('\n')
+	ok, err := p.st.checkPassphrase(bytes.TrimRight(line, "\r\n"))
+	if err != nil {
+		l.Printf("checking passphrase: %v\n", err)
+	}
+	if !ok {
+		l.Printf("wrong passphrase to unlock %s\n", strings.Join(paths, " "))
+	}
+	return ok
+}
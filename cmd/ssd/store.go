@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/server"
+)
+
+type storedItem struct {
+	Label       string            `json:"label"`
+	Type        string            `json:"type,omitempty"`
+	Attributes  map[string]string `json:"attributes"`
+	Created     time.Time         `json:"created"`
+	Modified    time.Time         `json:"modified"`
+	Secret      []byte            `json:"secret"`
+	ContentType string            `json:"content_type"`
+}
+
+type storedCollection struct {
+	Label    string                 `json:"label"`
+	Created  time.Time              `json:"created"`
+	Modified time.Time              `json:"modified"`
+	Items    map[string]*storedItem `json:"items"`
+	// Locking only lasts until the daemon exits: the whole file is
+	// unlocked by the passphrase.
+	locked bool
+}
+
+type contents struct {
+	Collections map[string]*storedCollection `json:"collections"`
+	Aliases     map[string]string            `json:"aliases"`
+	Serial      int                          `json:"serial"`
+}
+
+// store is a server.Backend kept in an encrypted file. Every change is
+// written out before it's reported as done.
+type store struct {
+	path   string
+	header header
+	key    []byte
+
+	mu sync.Mutex
+	c  contents
+}
+
+// openStore reads the file at path, or starts a new one with a "login"
+// collection as the "default" alias if there's nothing there.
+func openStore(path string, passphrase []byte, kdf string) (*store, error) {
+	s := &store{path: path}
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if s.header, err = newHeader(kdf); err != nil {
+			return nil, err
+		}
+		if s.key, err = s.header.key(passphrase); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		s.c = contents{
+			Collections: map[string]*storedCollection{
+				"login": {Label: "Login", Created: now, Modified: now, Items: map[string]*storedItem{}},
+			},
+			Aliases: map[string]string{"default": "login"},
+		}
+		return s, s.write(&s.c)
+	case err != nil:
+		return nil, err
+	}
+	var plaintext []byte
+	if s.header, s.key, plaintext, err = open(b, passphrase); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := json.Unmarshal(plaintext, &s.c); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return s, nil
+}
+
+// checkPassphrase reports whether passphrase is the one the file is
+// encrypted with.
+func (s *store) checkPassphrase(passphrase []byte) (bool, error) {
+	key, err := s.header.key(passphrase)
+	if err != nil {
+		return false, err
+	}
+	defer ss.Wipe(key)
+	return subtle.ConstantTimeCompare(key, s.key) == 1, nil
+}
+
+// update makes change to a copy of the contents, and only keeps the copy
+// once it's written out, so a failed write leaves the old contents in
+// place. It expects s.mu to be held.
+func (s *store) update(change func(c *contents) error) error {
+	c := s.c.clone()
+	if err := change(&c); err != nil {
+		return err
+	}
+	if err := s.write(&c); err != nil {
+		return err
+	}
+	s.c = c
+	return nil
+}
+
+// clone copies c down to the items, which changes replace rather than
+// modify.
+func (c *contents) clone() contents {
+	ret := contents{
+		Collections: make(map[string]*storedCollection, len(c.Collections)),
+		Aliases:     make(map[string]string, len(c.Aliases)),
+		Serial:      c.Serial,
+	}
+	for id, coll := range c.Collections {
+		cc := *coll
+		cc.Items = make(map[string]*storedItem, len(coll.Items))
+		for iid, i := range coll.Items {
+			ci := *i
+			cc.Items[iid] = &ci
+		}
+		ret.Collections[id] = &cc
+	}
+	for k, v := range c.Aliases {
+		ret.Aliases[k] = v
+	}
+	return ret
+}
+
+// write writes c to the file, replacing the old one only once the new one
+// is complete.
+func (s *store) write(c *contents) error {
+	plaintext, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	b, err := seal(s.header, s.key, plaintext)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (c *contents) collection(id string) (*storedCollection, error) {
+	coll, ok := c.Collections[id]
+	if !ok {
+		return nil, fmt.Errorf("collection %q: %w", id, ss.NoSuchObject)
+	}
+	return coll, nil
+}
+
+func (c *contents) item(coll, id string) (*storedCollection, *storedItem, error) {
+	sc, err := c.collection(coll)
+	if err != nil {
+		return nil, nil, err
+	}
+	i, ok := sc.Items[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("item %q: %w", id, ss.NoSuchObject)
+	}
+	return sc, i, nil
+}
+
+func (s *store) Collections() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.c.Collections))
+	for id := range s.c.Collections {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *store) Collection(id string) (server.Collection, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.c.collection(id)
+	if err != nil {
+		return server.Collection{}, err
+	}
+	return server.Collection{Label: c.Label, Locked: c.locked, Created: c.Created, Modified: c.Modified}, nil
+}
+
+func (s *store) CreateCollection(label string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var id string
+	err := s.update(func(c *contents) error {
+		c.Serial++
+		id = fmt.Sprintf("c%d", c.Serial)
+		now := time.Now()
+		c.Collections[id] = &storedCollection{Label: label, Created: now, Modified: now, Items: map[string]*storedItem{}}
+		return nil
+	})
+	return id, err
+}
+
+func (s *store) SetCollectionLabel(id, label string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func(c *contents) error {
+		coll, err := c.collection(id)
+		if err != nil {
+			return err
+		}
+		coll.Label, coll.Modified = label, time.Now()
+		return nil
+	})
+}
+
+func (s *store) DeleteCollection(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func(c *contents) error {
+		if _, err := c.collection(id); err != nil {
+			return err
+		}
+		delete(c.Collections, id)
+		for a, coll := range c.Aliases {
+			if coll == id {
+				delete(c.Aliases, a)
+			}
+		}
+		return nil
+	})
+}
+
+func (s *store) setLocked(id string, locked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.c.collection(id)
+	if err != nil {
+		return err
+	}
+	c.locked = locked
+	return nil
+}
+
+func (s *store) Lock(id string) error {
+	return s.setLocked(id, true)
+}
+
+func (s *store) Unlock(id string) error {
+	return s.setLocked(id, false)
+}
+
+func (s *store) Aliases() (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret := make(map[string]string, len(s.c.Aliases))
+	for k, v := range s.c.Aliases {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func (s *store) SetAlias(name, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func(c *contents) error {
+		if id == "" {
+			delete(c.Aliases, name)
+			return nil
+		}
+		if _, err := c.collection(id); err != nil {
+			return err
+		}
+		c.Aliases[name] = id
+		return nil
+	})
+}
+
+func (s *store) Items(coll string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.c.collection(coll)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(c.Items))
+	for id := range c.Items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *store) Item(coll, id string) (server.Item, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, i, err := s.c.item(coll, id)
+	if err != nil {
+		return server.Item{}, err
+	}
+	return server.Item{
+		Label:      i.Label,
+		Type:       i.Type,
+		Attributes: i.Attributes,
+		Created:    i.Created,
+		Modified:   i.Modified,
+	}, nil
+}
+
+func (s *store) CreateItem(coll string, i server.Item, sec server.Secret) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var id string
+	err := s.update(func(c *contents) error {
+		sc, err := c.collection(coll)
+		if err != nil {
+			return err
+		}
+		c.Serial++
+		id = fmt.Sprint(c.Serial)
+		now := time.Now()
+		sc.Items[id] = &storedItem{
+			Label:       i.Label,
+			Type:        i.Type,
+			Attributes:  i.Attributes,
+			Created:     now,
+			Modified:    now,
+			Secret:      sec.Value,
+			ContentType: sec.ContentType,
+		}
+		sc.Modified = now
+		return nil
+	})
+	return id, err
+}
+
+func (s *store) SetItem(coll, id string, i server.Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func(c *contents) error {
+		_, old, err := c.item(coll, id)
+		if err != nil {
+			return err
+		}
+		old.Label, old.Type, old.Attributes, old.Modified = i.Label, i.Type, i.Attributes, time.Now()
+		return nil
+	})
+}
+
+func (s *store) DeleteItem(coll, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func(c *contents) error {
+		sc, _, err := c.item(coll, id)
+		if err != nil {
+			return err
+		}
+		delete(sc.Items, id)
+		sc.Modified = time.Now()
+		return nil
+	})
+}
+
+func (s *store) GetSecret(coll, id string) (server.Secret, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, i, err := s.c.item(coll, id)
+	if err != nil {
+		return server.Secret{}, err
+	}
+	return server.Secret{Value: i.Secret, ContentType: i.ContentType}, nil
+}
+
+func (s *store) SetSecret(coll, id string, sec server.Secret) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(func(c *contents) error {
+		_, i, err := c.item(coll, id)
+		if err != nil {
+			return err
+		}
+		i.Secret, i.ContentType, i.Modified = sec.Value, sec.ContentType, time.Now()
+		return nil
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice/server"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, kdf := range []string{kdfArgon2id, kdfScrypt} {
+		t.Run(kdf, func(t *testing.T) {
+			path := filepath.Join(dir, kdf)
+			pass := []byte("correct horse")
+			s, err := openStore(path, pass, kdf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := s.CreateItem("login", server.Item{Label: "x", Attributes: map[string]string{"a": "b"}}, server.Secret{Value: []byte("hunter2"), ContentType: "text/plain"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err = openStore(path, pass, kdf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sec, err := s.GetSecret("login", id)
+			if err != nil || string(sec.Value) != "hunter2" {
+				t.Errorf("GetSecret after reopening: got %q, %v", sec.Value, err)
+			}
+			if a, _ := s.Aliases(); a["default"] != "login" {
+				t.Errorf("got aliases %v", a)
+			}
+
+			if _, err := openStore(path, []byte("wrong"), kdf); err == nil {
+				t.Error("expected an error with the wrong passphrase")
+			}
+		})
+	}
+}
+
+func TestTamper(t *testing.T) {
+	h, err := newHeader(kdfScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pass := []byte("pass")
+	key, err := h.key(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := seal(h, key, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, p, err := open(b, pass); err != nil || string(p) != "{}" {
+		t.Fatalf("open: got %q, %v", p, err)
+	}
+	// Weakening the KDF has to be noticed.
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	f.Header.N = 1 << 10
+	if b, err = json.Marshal(f); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := open(b, pass); err == nil {
+		t.Error("expected an error from changed KDF parameters")
+	}
+}
+
+func TestCommandPrompter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := openStore(filepath.Join(dir, "keyring"), []byte("pw"), kdfScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock := server.PromptRequest{Kind: server.PromptUnlock, Objects: []dbus.ObjectPath{"/x"}}
+	for _, c := range []struct {
+		command string
+		want    bool
+	}{
+		{`echo pw`, true},
+		{`test "$SSD_UNLOCK" = /x && printf 'pw\nmore'`, true},
+		{`echo wrong`, false},
+		{`echo pw; exit 1`, false},
+	} {
+		p := &commandPrompter{command: c.command, st: st}
+		if got := p.Prompt(context.Background(), unlock); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.command, got, c.want)
+		}
+	}
+}
+
+func TestFailedSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keyring")
+	s, err := openStore(path, []byte("pw"), kdfScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Under a file, so the directory can't be made, even as root.
+	s.path = filepath.Join(path, "keyring")
+	if _, err := s.CreateItem("login", server.Item{Label: "x"}, server.Secret{Value: []byte("y")}); err == nil {
+		t.Fatal("CreateItem: expected an error")
+	}
+	if err := s.SetAlias("default", ""); err == nil {
+		t.Fatal("SetAlias: expected an error")
+	}
+	if ids, _ := s.Items("login"); len(ids) != 0 {
+		t.Errorf("item kept after a failed save: %v", ids)
+	}
+	if a, _ := s.Aliases(); a["default"] != "login" {
+		t.Errorf("alias dropped after a failed save: %v", a)
+	}
+
+	// The next save mustn't carry the failed changes either.
+	s.path = path
+	if _, err := s.CreateCollection("other"); err != nil {
+		t.Fatal(err)
+	}
+	s, err = openStore(path, []byte("pw"), kdfScrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := s.Items("login"); len(ids) != 0 {
+		t.Errorf("failed item written later: %v", ids)
+	}
+}
@@ -3,129 +3,247 @@
 package ss
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/rand"
-	"crypto/sha256"
 	"fmt"
 	"io"
 	"time"
 
-	"golang.org/x/crypto/hkdf"
 	dbus "github.com/guelfey/go.dbus"
-	"github.com/monnand/dhkx"
+	"github.com/hdonnay/secretservice/internal/bus"
 )
 
-type Prompt struct{ *dbus.Object }
+type Prompt struct {
+	*dbus.Object
+	client *Client
+}
 
 // This runs the prompt.
 //
 // The prompt will timeout after 1 minute
 func (p Prompt) Prompt(window_id string) (dbus.Variant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), promptTimeout)
+	defer cancel()
+	v, err := p.PromptContext(ctx, window_id)
+	if err == context.DeadlineExceeded {
+		err = Timeout
+	}
+	return v, err
+}
+
+// PromptContext runs the prompt until it completes or ctx is done. If ctx is
+// done first, the prompt is dismissed and ctx.Err() is returned.
+func (p Prompt) PromptContext(ctx context.Context, window_id string) (dbus.Variant, error) {
 	// spec: Prompt(IN String window-id);
+	// signal: Completed(OUT Boolean dismissed, OUT Variant result);
 	empty := dbus.Variant{}
-	conn, err := dbus.SessionBus()
+	// Subscribe first, or a quick prompt could complete before we listen.
+	sub, err := p.client.subscribe(bus.Match{Path: p.Path(), Iface: _Prompt, Member: "Completed"})
 	if err != nil {
 		return empty, err
 	}
-	cmp := make(chan *dbus.Signal, 5)
-	conn.Signal(cmp)
-	call := p.Call(_PromptPrompt, 0, window_id)
-	if call.Err != nil {
-		return empty, call.Err
+	defer sub.Cancel()
+	c := call(ctx, p.Object, _PromptPrompt, window_id)
+	if c.Err != nil {
+		if ctx.Err() != nil {
+			p.abandon()
+		}
+		return empty, c.Err
 	}
-	for {
-		select {
-		case sig := <-cmp:
-			if sig.Name == _PromptCompleted {
-				if sig.Body[0].(bool) {
-					return empty, PromptDismissed
-				}
-				return sig.Body[1].(dbus.Variant), nil
-			}
-		case <-time.After(time.Duration(time.Minute)):
-			err := p.Dismiss()
-			if err != nil {
-				panic(err)
-			}
-			return empty, Timeout
+	select {
+	case sig, ok := <-sub.C:
+		if !ok {
+			return empty, ServiceGone
+		}
+		var dismissed bool
+		var result dbus.Variant
+		if err := dbus.Store(sig.Body, &dismissed, &result); err != nil {
+			return empty, err
 		}
+		if dismissed {
+			return empty, PromptDismissed
+		}
+		return result, nil
+	case <-ctx.Done():
+		p.abandon()
+		return empty, ctx.Err()
 	}
 }
 
 // Make a prompt go away.
 func (p Prompt) Dismiss() error {
+	return p.DismissContext(context.Background())
+}
+
+func (p Prompt) DismissContext(ctx context.Context) error {
 	// spec: Dismiss(void);
-	return p.Call(_PromptDismiss, 0).Err
+	return call(ctx, p.Object, _PromptDismiss).Err
 }
 
-type Item struct{ *dbus.Object }
+// abandon dismisses a prompt the caller has stopped waiting on. The caller's
+// context is already done at this point, so this uses its own deadline, and
+// the error is dropped: the caller gets ctx.Err() either way.
+func (p Prompt) abandon() {
+	ctx, cancel := context.WithTimeout(context.Background(), dismissTimeout)
+	defer cancel()
+	p.DismissContext(ctx)
+}
+
+type Item struct {
+	*dbus.Object
+	client *Client
+}
 
 // Use the passed Session to set the Secret in this Item
 func (i Item) SetSecret(s Secret) error {
+	return i.SetSecretContext(context.Background(), s)
+}
+
+func (i Item) SetSecretContext(ctx context.Context, s Secret) error {
 	// spec: SetSecret(IN Secret secret);
-	return simpleCall(i.Path(), _ItemSetSecret, s)
+	return i.client.simpleCall(ctx, i.Object, _ItemSetSecret, s)
 }
 
 // Use the passed Session to retrieve the Secret in this Item
 func (i Item) GetSecret(s Session) (Secret, error) {
+	return i.GetSecretContext(context.Background(), s)
+}
+
+func (i Item) GetSecretContext(ctx context.Context, s Session) (Secret, error) {
 	// spec: GetSecret(IN ObjectPath session, OUT Secret secret);
 	var ret Secret
-	call := i.Call(_ItemGetSecret, 0, s.Path())
-	if call.Err != nil {
-		return ret, call.Err
+	c := call(ctx, i.Object, _ItemGetSecret, s.Path())
+	if c.Err != nil {
+		return ret, c.Err
 	}
-	call.Store(&ret)
-	return ret, nil
+	err := c.Store(&ret)
+	return ret, err
 }
 
 // Any prompt should be handled transparently.
 func (i Item) Delete() error {
+	return i.DeleteContext(context.Background())
+}
+
+func (i Item) DeleteContext(ctx context.Context) error {
 	// spec: Delete (OUT ObjectPath Prompt);
-	return simpleCall(i.Path(), _ItemDelete)
+	return i.client.simpleCall(ctx, i.Object, _ItemDelete)
+}
+func (i Item) Locked() (bool, error) {
+	return i.LockedContext(context.Background())
 }
-func (i Item) Locked() bool {
-	v, err := i.GetProperty(_ItemLocked)
+func (i Item) LockedContext(ctx context.Context) (bool, error) {
+	var l bool
+	err := storeProperty(ctx, i.Object, _ItemLocked, &l)
+	return l, err
+}
+func (i Item) Created() (time.Time, error) {
+	return i.CreatedContext(context.Background())
+}
+func (i Item) CreatedContext(ctx context.Context) (time.Time, error) {
+	var t uint64
+	err := storeProperty(ctx, i.Object, _ItemCreated, &t)
+	return time.Unix(int64(t), 0), err
+}
+func (i Item) Modified() (time.Time, error) {
+	return i.ModifiedContext(context.Background())
+}
+func (i Item) ModifiedContext(ctx context.Context) (time.Time, error) {
+	var t uint64
+	err := storeProperty(ctx, i.Object, _ItemModified, &t)
+	return time.Unix(int64(t), 0), err
+}
+func (i Item) GetAttributes() (map[string]string, error) {
+	return i.GetAttributesContext(context.Background())
+}
+func (i Item) GetAttributesContext(ctx context.Context) (map[string]string, error) {
+	var attr map[string]string
+	err := storeProperty(ctx, i.Object, _ItemAttributes, &attr)
+	return attr, err
+}
+func (i Item) SetAttributes(attr map[string]string) error {
+	return i.SetAttributesContext(context.Background(), attr)
+}
+func (i Item) SetAttributesContext(ctx context.Context, attr map[string]string) error {
+	return setProperty(ctx, i.Object, _ItemAttributes, attr)
+}
+func (i Item) GetLabel() (string, error) {
+	return i.GetLabelContext(context.Background())
+}
+func (i Item) GetLabelContext(ctx context.Context) (string, error) {
+	var l string
+	err := storeProperty(ctx, i.Object, _ItemLabel, &l)
+	return l, err
+}
+func (i Item) SetLabel(l string) error {
+	return i.SetLabelContext(context.Background(), l)
+}
+func (i Item) SetLabelContext(ctx context.Context, l string) error {
+	return setProperty(ctx, i.Object, _ItemLabel, l)
+}
+func (i Item) GetType() (string, error) {
+	return i.GetTypeContext(context.Background())
+}
+func (i Item) GetTypeContext(ctx context.Context) (string, error) {
+	var t string
+	err := storeProperty(ctx, i.Object, _ItemType, &t)
+	return t, err
+}
+func (i Item) SetType(t string) error {
+	return i.SetTypeContext(context.Background(), t)
+}
+func (i Item) SetTypeContext(ctx context.Context, t string) error {
+	return setProperty(ctx, i.Object, _ItemType, t)
+}
+
+// The Must* accessors panic if the property can't be read.
+
+func (i Item) MustLocked() bool {
+	l, err := i.Locked()
 	if err != nil {
 		panic(err)
 	}
-	return v.Value().(bool)
+	return l
 }
-func (i Item) Created() time.Time {
-	v, err := i.GetProperty(_ItemCreated)
+func (i Item) MustCreated() time.Time {
+	t, err := i.Created()
 	if err != nil {
 		panic(err)
 	}
-	return time.Unix(int64(v.Value().(uint64)), 0)
+	return t
 }
-func (i Item) Modified() time.Time {
-	v, err := i.GetProperty(_ItemModified)
+func (i Item) MustModified() time.Time {
+	t, err := i.Modified()
 	if err != nil {
 		panic(err)
 	}
-	return time.Unix(int64(v.Value().(uint64)), 0)
+	return t
 }
-func (i Item) GetAttributes() map[string]string {
-	v, err := i.GetProperty(_ItemAttributes)
+func (i Item) MustGetAttributes() map[string]string {
+	attr, err := i.GetAttributes()
 	if err != nil {
 		panic(err)
 	}
-	return v.Value().(map[string]string)
-}
-func (i Item) SetAttributes(attr map[string]string) error {
-	return i.Call(setProp, 0, _Item, "Attributes", attr).Err
+	return attr
 }
-func (i Item) GetLabel() string {
-	v, err := i.GetProperty(_ItemLabel)
+func (i Item) MustGetLabel() string {
+	l, err := i.GetLabel()
 	if err != nil {
 		panic(err)
 	}
-	return v.Value().(string)
+	return l
 }
-func (i Item) SetLabel(l string) error {
-	return i.Call(setProp, 0, _Item, "Label", l).Err
+
+type Service struct {
+	*dbus.Object
+	client *Client
 }
 
-type Service struct{ *dbus.Object }
+// Client returns the Client every object derived from s shares.
+func (s Service) Client() *Client {
+	return s.client
+}
 
 // First argument is the algorithm used. "plain" (AlgoPlain) and
 // "dh-ietf1024-sha256-aes128-cbc-pkcs7" (AlgoDH) are supported.
@@ -134,47 +252,31 @@ type Service struct{ *dbus.Object }
 // the other side's public key, but this implementation generates a
 // new keypair, does the exchange, derives the encryption key, and then
 // stores it in the returned Session.
+//
+// AlgoPlain fails with PlainForbidden if the Client's SessionPolicy is
+// ForbidPlain. See NegotiateSession for picking the algorithm.
 func (s Service) OpenSession(algo string, args ...interface{}) (Session, error) {
+	return s.OpenSessionContext(context.Background(), algo, args...)
+}
+
+func (s Service) OpenSessionContext(ctx context.Context, algo string, args ...interface{}) (Session, error) {
 	// spec: OpenSession(IN String algorithm, IN Variant input, OUT Variant output, OUT ObjectPath result);
 	var ret Session
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		return ret, err
-	}
+	var err error
 	switch algo {
 	case AlgoPlain:
+		if s.client.SessionPolicy == ForbidPlain {
+			return ret, PlainForbidden
+		}
 		var discard dbus.Variant
 		var sessionPath dbus.ObjectPath
-		err = s.Call(_ServiceOpenSession, 0, algo, dbus.MakeVariant("")).Store(&discard, &sessionPath)
+		err = call(ctx, s.Object, _ServiceOpenSession, algo, dbus.MakeVariant("")).Store(&discard, &sessionPath)
 		if err != nil {
 			return ret, err
 		}
-		ret = Session{conn.Object(ServiceName, sessionPath), algo, nil}
+		ret = s.client.session(sessionPath, algo, nil)
 	case AlgoDH:
-		// see http://standards.freedesktop.org/secret-service/ch07s03.html
-		var sessionPath dbus.ObjectPath
-		var srvReply dbus.Variant
-		var srvPub []byte
-		symKey := make([]byte, aes.BlockSize)
-		grp, err := dhkx.GetGroup(2)
-		if err != nil {
-			return ret, err
-		}
-		privKey, err := grp.GeneratePrivateKey(rand.Reader)
-		if err != nil {
-			return ret, err
-		}
-		err = s.Call(_ServiceOpenSession, 0, algo, dbus.MakeVariant(privKey.Bytes())).Store(&srvReply, &sessionPath)
-		if err != nil {
-			return ret, err
-		}
-		srvPub = srvReply.Value().([]byte)
-		sharedKey, err := grp.ComputeKey(dhkx.NewPublicKey(srvPub), privKey)
-		if err != nil {
-			return ret, err
-		}
-		_, err = io.ReadFull(hkdf.New(sha256.New, sharedKey.Bytes(), nil, nil), symKey)
-		ret = Session{conn.Object(ServiceName, sessionPath), algo, symKey}
+		ret, err = s.openDH(ctx)
 	default:
 		err = InvalidAlgorithm
 	}
@@ -183,274 +285,490 @@ func (s Service) OpenSession(algo string, args ...interface{}) (Session, error)
 
 // The first argument is the Label for the collection, and the second is an (optional) alias.
 func (s Service) CreateCollection(label, alias string) (Collection, error) {
+	return s.CreateCollectionContext(context.Background(), label, alias)
+}
+
+func (s Service) CreateCollectionContext(ctx context.Context, label, alias string) (Collection, error) {
+	properties := map[string]dbus.Variant{
+		CollectionLabelProperty: dbus.MakeVariant(label),
+	}
+	return s.CreateCollectionWithPropertiesContext(ctx, properties, alias)
+}
+
+// Like CreateCollection, but with arbitrary properties, keyed by their
+// fully-qualified names (CollectionLabelProperty, for example).
+func (s Service) CreateCollectionWithProperties(properties map[string]dbus.Variant, alias string) (Collection, error) {
+	return s.CreateCollectionWithPropertiesContext(context.Background(), properties, alias)
+}
+
+func (s Service) CreateCollectionWithPropertiesContext(ctx context.Context, properties map[string]dbus.Variant, alias string) (Collection, error) {
 	// spec: CreateCollection(IN Dict<String,Variant> properties, IN String alias, OUT ObjectPath collection, OUT ObjectPath prompt);
 	var collectionPath, promptPath dbus.ObjectPath
-	conn, err := dbus.SessionBus()
+	c := call(ctx, s.Object, _ServiceCreateCollection, properties, alias)
+	if c.Err != nil {
+		return Collection{}, c.Err
+	}
+	err := c.Store(&collectionPath, &promptPath)
 	if err != nil {
 		return Collection{}, err
 	}
-	properties := map[string]dbus.Variant{
-		_CollectionLabel: dbus.MakeVariant(label),
+	if noPrompt != collectionPath {
+		return s.client.Collection(collectionPath), nil
 	}
-	call := s.Call(_ServiceCreateCollection, 0, properties, alias)
-	if call.Err != nil {
-		return Collection{}, call.Err
-	}
-	err = call.Store(&collectionPath, &promptPath)
+	v, err := s.client.checkPrompt(ctx, promptPath)
 	if err != nil {
 		return Collection{}, err
 	}
-	if dbus.ObjectPath("/") != collectionPath {
-		return Collection{conn.Object(ServiceName, collectionPath)}, nil
-	}
-	v, err := checkPrompt(promptPath)
+	err = dbus.Store([]interface{}{v.Value()}, &collectionPath)
 	if err != nil {
 		return Collection{}, err
 	}
-	return Collection{conn.Object(ServiceName, dbus.ObjectPath(v.Value().(string)))},
-		fmt.Errorf("unable to create collection")
+	return s.client.Collection(collectionPath), nil
 }
 
 func (s Service) SearchItems(attrs map[string]string) ([]Item, []Item, error) {
+	return s.SearchItemsContext(context.Background(), attrs)
+}
+
+func (s Service) SearchItemsContext(ctx context.Context, attrs map[string]string) ([]Item, []Item, error) {
 	// spec: SearchItems(IN Dict<String,String> attributes, OUT Array<ObjectPath> unlocked, OUT Array<ObjectPath> locked);
 	var unlocked, locked []dbus.ObjectPath
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		return []Item{}, []Item{}, err
-	}
-	call := s.Call(_ServiceSearchItems, 0, attrs)
-	err = call.Store(&unlocked, &locked)
+	err := call(ctx, s.Object, _ServiceSearchItems, attrs).Store(&unlocked, &locked)
 	if err != nil {
 		return []Item{}, []Item{}, err
 	}
 	retUnlocked := make([]Item, len(unlocked))
 	retLocked := make([]Item, len(locked))
 	for i, v := range unlocked {
-		retUnlocked[i] = Item{conn.Object(ServiceName, v)}
+		retUnlocked[i] = s.client.Item(v)
 	}
 	for i, v := range locked {
-		retLocked[i] = Item{conn.Object(ServiceName, v)}
+		retLocked[i] = s.client.Item(v)
 	}
 	return retUnlocked, retLocked, nil
 }
 
-// UNIMPLEMENTED
-func (s Service) Unlock(o []dbus.ObjectPath) ([]dbus.ObjectPath, error) {
+// Unlock the passed Collections and Items. Any prompt is handled
+// transparently.
+//
+// The returned slice holds the objects that were actually unlocked, as
+// Collection and Item values.
+func (s Service) Unlock(o []Object) ([]Object, error) {
+	return s.UnlockContext(context.Background(), o)
+}
+
+func (s Service) UnlockContext(ctx context.Context, o []Object) ([]Object, error) {
 	// spec: Unlock(IN Array<ObjectPath> objects, OUT Array<ObjectPath> unlocked, OUT ObjectPath prompt);
-	var ret []dbus.ObjectPath
+	return s.lockUnlock(ctx, _ServiceUnlock, o)
+}
+
+// Lock the passed Collections and Items. Any prompt is handled
+// transparently.
+//
+// The returned slice holds the objects that were actually locked, as
+// Collection and Item values.
+func (s Service) Lock(o []Object) ([]Object, error) {
+	return s.LockContext(context.Background(), o)
+}
+
+func (s Service) LockContext(ctx context.Context, o []Object) ([]Object, error) {
+	// spec: Lock(IN Array<ObjectPath> objects, OUT Array<ObjectPath> locked, OUT ObjectPath Prompt);
+	return s.lockUnlock(ctx, _ServiceLock, o)
+}
+
+// Lock and Unlock have the same shape: the objects changed without a prompt
+// are returned directly, and the rest come back as the prompt's result.
+func (s Service) lockUnlock(ctx context.Context, method string, o []Object) ([]Object, error) {
+	var done []dbus.ObjectPath
 	var prompt dbus.ObjectPath
-	call := s.Call(_ServiceUnlock, 0, o)
-	if call.Err != nil {
-		return []dbus.ObjectPath{}, call.Err
+	c := call(ctx, s.Object, method, objectPaths(o))
+	if c.Err != nil {
+		return []Object{}, c.Err
 	}
-	err := call.Store(&ret, &prompt)
+	err := c.Store(&done, &prompt)
 	if err != nil {
-		return []dbus.ObjectPath{}, call.Err
+		return []Object{}, err
 	}
-	v, err := checkPrompt(prompt)
+	v, err := s.client.checkPrompt(ctx, prompt)
 	if err != nil {
-		return []dbus.ObjectPath{}, call.Err
+		return []Object{}, err
 	}
-	for _, o := range v.Value().([]dbus.ObjectPath) {
-		ret = append(ret, o)
+	if p, ok := v.Value().([]dbus.ObjectPath); ok {
+		done = append(done, p...)
 	}
-	return ret, nil
+	return resolveObjects(s.client, o, done), nil
 }
 
-// UNIMPLEMENTED
-func (s Service) Lock(o []Object) ([]Object, error) {
-	// spec: Lock(IN Array<ObjectPath> objects, OUT Array<ObjectPath> locked, OUT ObjectPath Prompt);
-	return nil, nil
+// The specified action is to return map[ObjectPath]Secret, which is what this
+// does. See GetSecretValues for something more useful.
+func (s Service) GetSecrets(items []Item, ses Session) (map[dbus.ObjectPath]Secret, error) {
+	return s.GetSecretsContext(context.Background(), items, ses)
 }
 
-// The specified action is to return map[ObjectPath]Secret, but map[Label]Secret is much more useful.
-func (s Service) GetSecrets(items []Item, ses Session) (map[dbus.ObjectPath]Secret, error) {
+func (s Service) GetSecretsContext(ctx context.Context, items []Item, ses Session) (map[dbus.ObjectPath]Secret, error) {
 	// spec: GetSecrets(IN Array<ObjectPath> items, IN ObjectPath session, OUT Dict<ObjectPath,Secret> secrets);
 	arg := make([]dbus.ObjectPath, len(items))
 	for i, o := range items {
 		arg[i] = o.Path()
 	}
-	call := s.Call(_ServiceGetSecrets, 0, arg, ses.Path())
-	if call.Err != nil {
-		return map[dbus.ObjectPath]Secret{}, call.Err
+	c := call(ctx, s.Object, _ServiceGetSecrets, arg, ses.Path())
+	if c.Err != nil {
+		return map[dbus.ObjectPath]Secret{}, c.Err
 	}
-	ret := make(map[dbus.ObjectPath]Secret)
-	err := call.Store(&ret)
-	return ret, err
+	return storeSecrets(c)
+}
+
+// ItemSecret is what GetSecretValues found for one Item.
+type ItemSecret struct {
+	Label       string
+	Attributes  map[string]string
+	Value       []byte
+	ContentType string
+	// Set if the secret couldn't be read; Label and Attributes may still
+	// be filled in. Locked items get IsLocked.
+	Err error
+}
+
+// GetSecretValues reads and decrypts the secrets of all the passed Items
+// at once, along with their labels and attributes. Only errors that affect
+// every Item are returned directly; anything specific to one Item is in its
+// ItemSecret.
+func (s Service) GetSecretValues(items []Item, ses Session) (map[Item]ItemSecret, error) {
+	return s.GetSecretValuesContext(context.Background(), items, ses)
+}
+
+func (s Service) GetSecretValuesContext(ctx context.Context, items []Item, ses Session) (map[Item]ItemSecret, error) {
+	// The secrets come from one GetSecrets call, and the properties from
+	// a GetAll per Item. They're all sent before waiting on any of them, so
+	// this costs one round trip no matter how many Items there are.
+	done := make(chan *dbus.Call, len(items)+1)
+	secretsCall := s.Go(_ServiceGetSecrets, 0, done, objectPaths(itemObjects(items)), ses.Path())
+	propCalls := make([]*dbus.Call, len(items))
+	for i, item := range items {
+		propCalls[i] = item.Go(getAllProps, 0, done, _Item)
+	}
+	for n := 0; n < cap(done); n++ {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if secretsCall.Err != nil {
+		return nil, wrapError(s.Path(), secretsCall.Err)
+	}
+	secrets, err := storeSecrets(secretsCall)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[Item]ItemSecret, len(items))
+	for i, item := range items {
+		var r ItemSecret
+		var props map[string]dbus.Variant
+		var locked bool
+		if err := propCalls[i].Err; err != nil {
+			r.Err = wrapPropertyError(item.Path(), err)
+		} else if err := propCalls[i].Store(&props); err != nil {
+			r.Err = err
+		} else {
+			dbus.Store([]interface{}{props["Label"].Value()}, &r.Label)
+			dbus.Store([]interface{}{props["Attributes"].Value()}, &r.Attributes)
+			dbus.Store([]interface{}{props["Locked"].Value()}, &locked)
+		}
+		if sec, ok := secrets[item.Path()]; ok {
+			r.ContentType = sec.ContentType
+			r.Value, r.Err = sec.GetValue(ses)
+		} else if r.Err == nil {
+			if locked {
+				r.Err = &Error{Path: item.Path(), Err: IsLocked}
+			} else {
+				r.Err = &Error{Path: item.Path(), Err: fmt.Errorf("no secret returned")}
+			}
+		}
+		ret[item] = r
+	}
+	return ret, nil
 }
 
 func (s Service) ReadAlias(a string) (Collection, error) {
+	return s.ReadAliasContext(context.Background(), a)
+}
+
+func (s Service) ReadAliasContext(ctx context.Context, a string) (Collection, error) {
 	// spec: ReadAlias(IN String name, OUT ObjectPath collection);
 	var path dbus.ObjectPath
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		return Collection{}, err
+	c := call(ctx, s.Object, _ServiceReadAlias, a)
+	if c.Err != nil {
+		return Collection{}, c.Err
 	}
-	call := s.Call(_ServiceReadAlias, 0, a)
-	if call.Err != nil {
-		return Collection{}, call.Err
-	}
-	err = call.Store(&path)
+	err := c.Store(&path)
 	if err != nil {
 		return Collection{}, err
 	}
-	return Collection{conn.Object(ServiceName, path)}, nil
+	return s.client.Collection(path), nil
 }
 
 func (s Service) SetAlias(a string, c Collection) error {
+	return s.SetAliasContext(context.Background(), a, c)
+}
+
+func (s Service) SetAliasContext(ctx context.Context, a string, c Collection) error {
 	// spec: SetAlias(IN String name, IN ObjectPath collection);
-	return simpleCall(s.Path(), _ServiceSetAlias, a, c.Path())
+	return s.client.simpleCall(ctx, s.Object, _ServiceSetAlias, a, c.Path())
 }
 
 // List Colletions
-func (s Service) Collections() []Collection {
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		panic(err)
-	}
-	v, err := s.GetProperty(_ServiceCollections)
+func (s Service) Collections() ([]Collection, error) {
+	return s.CollectionsContext(context.Background())
+}
+
+func (s Service) CollectionsContext(ctx context.Context) ([]Collection, error) {
+	var paths []dbus.ObjectPath
+	err := storeProperty(ctx, s.Object, _ServiceCollections, &paths)
 	if err != nil {
-		panic(err)
+		return []Collection{}, err
 	}
-	paths := v.Value().([]dbus.ObjectPath)
 	out := make([]Collection, len(paths))
 	for i, path := range paths {
-		out[i] = Collection{conn.Object(ServiceName, path)}
+		out[i] = s.client.Collection(path)
 	}
-	return out
+	return out, nil
+}
+
+// Like Collections, but panics on error.
+func (s Service) MustCollections() []Collection {
+	c, err := s.Collections()
+	if err != nil {
+		panic(err)
+	}
+	return c
 }
 
 // type Collection implements the org.freedesktop.SecretService.Collection
 // interface, using function calls for property accessors/setters
-type Collection struct{ *dbus.Object }
+type Collection struct {
+	*dbus.Object
+	client *Client
+}
 
 func (c Collection) Delete() error {
+	return c.DeleteContext(context.Background())
+}
+
+func (c Collection) DeleteContext(ctx context.Context) error {
 	// spec: Delete(OUT ObjectPath prompt);
-	return simpleCall(c.Path(), _CollectionDelete)
+	return c.client.simpleCall(ctx, c.Object, _CollectionDelete)
 }
 
 func (c Collection) SearchItems(attr map[string]string) ([]Item, error) {
+	return c.SearchItemsContext(context.Background(), attr)
+}
+
+func (c Collection) SearchItemsContext(ctx context.Context, attr map[string]string) ([]Item, error) {
 	// spec: SearchItems(IN Dict<String,String> attributes, OUT Array<ObjectPath> results);
 	i := []Item{}
-	conn, err := dbus.SessionBus()
+	var value []dbus.ObjectPath
+	err := call(ctx, c.Object, _CollectionSearchItems, attr).Store(&value)
 	if err != nil {
 		return i, err
 	}
-	call := c.Call(_CollectionSearchItems, 0, attr)
-	if call.Err != nil {
-		return i, call.Err
-	}
-	var value []dbus.ObjectPath
-	call.Store(&value)
 	for _, objPath := range value {
-		i = append(i, Item{conn.Object(ServiceName, objPath)})
+		i = append(i, c.client.Item(objPath))
 	}
 	return i, nil
 }
 
 func (c Collection) CreateItem(label string, attr map[string]string, s Secret, replace bool) (Item, error) {
+	return c.CreateItemContext(context.Background(), label, attr, s, replace)
+}
+
+func (c Collection) CreateItemContext(ctx context.Context, label string, attr map[string]string, s Secret, replace bool) (Item, error) {
+	return c.CreateItemWithPropertiesContext(ctx, ItemProperties(label, attr), s, replace)
+}
+
+// Like CreateItem, but with arbitrary properties, keyed by their
+// fully-qualified names. Start from ItemProperties and add to it, e.g.
+// ItemTypeProperty to record a schema the way libsecret does.
+func (c Collection) CreateItemWithProperties(prop map[string]dbus.Variant, s Secret, replace bool) (Item, error) {
+	return c.CreateItemWithPropertiesContext(context.Background(), prop, s, replace)
+}
+
+func (c Collection) CreateItemWithPropertiesContext(ctx context.Context, prop map[string]dbus.Variant, s Secret, replace bool) (Item, error) {
 	// spec: CreateItem(IN Dict<String,Variant> properties, IN Secret secret, IN Boolean replace, OUT ObjectPath item, OUT ObjectPath prompt);
-	i := Item{}
-	conn, err := dbus.SessionBus()
+	var itemPath, promptPath dbus.ObjectPath
+	res := call(ctx, c.Object, _CollectionCreateItem, prop, s, replace)
+	if res.Err != nil {
+		return Item{}, res.Err
+	}
+	err := res.Store(&itemPath, &promptPath)
 	if err != nil {
-		return i, err
+		return Item{}, err
 	}
-
-	prop := make(map[string]dbus.Variant)
-	prop[_ItemLabel] = dbus.MakeVariant(label)
-	prop[_ItemAttributes] = dbus.MakeVariant(attr)
-
-	call := c.Call(_CollectionCreateItem, 0, prop, s, replace)
-	if call.Err != nil {
-		return i, call.Err
+	if noPrompt != itemPath {
+		return c.client.Item(itemPath), nil
 	}
-	var newItem dbus.ObjectPath
-	call.Store(&newItem)
-
-	i = Item{conn.Object(ServiceName, newItem)}
+	v, err := c.client.checkPrompt(ctx, promptPath)
+	if err != nil {
+		return Item{}, err
+	}
+	err = dbus.Store([]interface{}{v.Value()}, &itemPath)
+	if err != nil {
+		return Item{}, err
+	}
+	return c.client.Item(itemPath), nil
+}
 
+// ItemProperties returns the properties CreateItem sends.
+func ItemProperties(label string, attr map[string]string) map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		ItemLabelProperty:      dbus.MakeVariant(label),
+		ItemAttributesProperty: dbus.MakeVariant(attr),
+	}
+}
+func (c Collection) Locked() (bool, error) {
+	return c.LockedContext(context.Background())
+}
+func (c Collection) LockedContext(ctx context.Context) (bool, error) {
+	var l bool
+	err := storeProperty(ctx, c.Object, _CollectionLocked, &l)
+	return l, err
+}
+func (c Collection) Created() (time.Time, error) {
+	return c.CreatedContext(context.Background())
+}
+func (c Collection) CreatedContext(ctx context.Context) (time.Time, error) {
+	var t uint64
+	err := storeProperty(ctx, c.Object, _CollectionCreated, &t)
+	return time.Unix(int64(t), 0).UTC(), err
+}
+func (c Collection) Modified() (time.Time, error) {
+	return c.ModifiedContext(context.Background())
+}
+func (c Collection) ModifiedContext(ctx context.Context) (time.Time, error) {
+	var t uint64
+	err := storeProperty(ctx, c.Object, _CollectionModified, &t)
+	return time.Unix(int64(t), 0).UTC(), err
+}
+func (c Collection) Items() ([]Item, error) {
+	return c.ItemsContext(context.Background())
+}
+func (c Collection) ItemsContext(ctx context.Context) ([]Item, error) {
+	var paths []dbus.ObjectPath
+	err := storeProperty(ctx, c.Object, _CollectionItems, &paths)
+	if err != nil {
+		return []Item{}, err
+	}
+	i := make([]Item, len(paths))
+	for idx, objPath := range paths {
+		i[idx] = c.client.Item(objPath)
+	}
 	return i, nil
 }
-func (c Collection) Locked() bool {
-	v, err := c.GetProperty(_CollectionLocked)
+func (c Collection) GetLabel() (string, error) {
+	return c.GetLabelContext(context.Background())
+}
+func (c Collection) GetLabelContext(ctx context.Context) (string, error) {
+	var l string
+	err := storeProperty(ctx, c.Object, _CollectionLabel, &l)
+	return l, err
+}
+func (c Collection) SetLabel(l string) error {
+	return c.SetLabelContext(context.Background(), l)
+}
+func (c Collection) SetLabelContext(ctx context.Context, l string) error {
+	return setProperty(ctx, c.Object, _CollectionLabel, l)
+}
+
+// The Must* accessors panic if the property can't be read.
+
+func (c Collection) MustLocked() bool {
+	l, err := c.Locked()
 	if err != nil {
 		panic(err)
 	}
-	l := v.Value()
-	return l.(bool)
+	return l
 }
-func (c Collection) Created() time.Time {
-	v, err := c.GetProperty(_CollectionCreated)
+func (c Collection) MustCreated() time.Time {
+	t, err := c.Created()
 	if err != nil {
 		panic(err)
 	}
-	return time.Unix(int64(v.Value().(uint64)), 0).UTC()
+	return t
 }
-func (c Collection) Modified() time.Time {
-	v, err := c.GetProperty(_CollectionModified)
+func (c Collection) MustModified() time.Time {
+	t, err := c.Modified()
 	if err != nil {
 		panic(err)
 	}
-	return time.Unix(int64(v.Value().(uint64)), 0).UTC()
+	return t
 }
-func (c Collection) Items() []Item {
-	// How did we get here if we can't get on the bus now?
-	conn, _ := dbus.SessionBus()
-	p, _ := c.GetProperty(_CollectionItems)
-	objs := p.Value().([]dbus.ObjectPath)
-	i := make([]Item, len(objs))
-	for idx, objPath := range objs {
-		i[idx] = Item{conn.Object(ServiceName, objPath)}
+func (c Collection) MustItems() []Item {
+	i, err := c.Items()
+	if err != nil {
+		panic(err)
 	}
 	return i
 }
-func (c Collection) GetLabel() string {
-	v, err := c.GetProperty(_CollectionLabel)
+func (c Collection) MustGetLabel() string {
+	l, err := c.GetLabel()
 	if err != nil {
 		panic(err)
 	}
-	return v.Value().(string)
-}
-func (c Collection) SetLabel(l string) error {
-	return c.Call(setProp, 0, _Collection, "Label", l).Err
+	return l
 }
 
 func (c Collection) Unlock() error {
-	conn, _ := dbus.SessionBus()
-	var prompt dbus.ObjectPath
-	u := make([]dbus.ObjectPath, 1)
-	srv := conn.Object(ServiceName, ServicePath)
-	call := srv.Call(_ServiceUnlock, 0, []dbus.ObjectPath{c.Path()})
-	if call.Err != nil {
-		return call.Err
-	}
-	if err := call.Store(&u, &prompt); err != nil {
-		return err
-	}
-	if _, err := checkPrompt(prompt); err != nil {
-		return err
-	}
-	return nil
+	return c.UnlockContext(context.Background())
+}
+
+func (c Collection) UnlockContext(ctx context.Context) error {
+	_, err := c.client.Service().UnlockContext(ctx, []Object{c})
+	return err
+}
+
+func (c Collection) Lock() error {
+	return c.LockContext(context.Background())
+}
+
+func (c Collection) LockContext(ctx context.Context) error {
+	_, err := c.client.Service().LockContext(ctx, []Object{c})
+	return err
 }
 
 type Session struct {
 	*dbus.Object
 	Algorithm string
 	Key       []byte
+	client    *Client
 }
 
 // Yes, really, it's the only method that exists on a Session.
+//
+// Close wipes Key, which every copy of s shares; none of them can be used
+// afterwards.
 func (s Session) Close() {
 	// spec: Close(void);
+	Wipe(s.Key)
 	s.Go(_SessionClose, dbus.FlagNoReplyExpected, nil)
 }
 
-func (s Session) NewSecret() Secret {
+// CloseContext is Close, but waits for the service to acknowledge it.
+func (s Session) CloseContext(ctx context.Context) error {
+	Wipe(s.Key)
+	return call(ctx, s.Object, _SessionClose).Err
+}
+
+// NewSecret returns an empty text/plain Secret for s, with a fresh IV if s is
+// encrypted.
+func (s Session) NewSecret() (Secret, error) {
 	r := Secret{s.Path(), nil, nil, text_plain}
 	switch s.Algorithm {
 	case AlgoDH:
 		r.Parameters = make([]byte, aes.BlockSize)
-		io.ReadFull(rand.Reader, r.Parameters)
+		if _, err := io.ReadFull(rand.Reader, r.Parameters); err != nil {
+			return Secret{}, err
+		}
 	}
-	return r
+	return r, nil
 }
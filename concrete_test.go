@@ -1,6 +1,8 @@
 package ss
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 
 	dbus "github.com/guelfey/go.dbus"
@@ -24,8 +26,11 @@ func TestBasicWorkflow(t *testing.T) {
 	var err error
 	//conn := getConn()
 	service, err := DialService()
+	if errors.Is(err, ErrServiceUnavailable) {
+		t.Skip("no secret service")
+	}
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
 	plain, err := service.OpenSession(AlgoPlain)
 	if err != nil {
@@ -40,10 +45,10 @@ func TestBasicWorkflow(t *testing.T) {
 		t.Error(err)
 	}
 	t.Logf("collection:%v\tcreated:%v\tmodified:%v\tlocked:%v\n",
-		testCollection.GetLabel(), testCollection.Created(),
-		testCollection.Modified(), testCollection.Locked())
+		testCollection.MustGetLabel(), testCollection.MustCreated(),
+		testCollection.MustModified(), testCollection.MustLocked())
 
-	if testCollection.Locked() {
+	if testCollection.MustLocked() {
 		err := testCollection.Unlock()
 		if err != nil {
 			t.Fatal(err)
@@ -53,8 +58,14 @@ func TestBasicWorkflow(t *testing.T) {
 	// this bit is kind of thorny.
 	// maybe make a "dbusSecret" type that gets serialized and we can work with
 	// "Secret"s?
-	secPlain := plain.NewSecret()
-	secCrypt := crypt.NewSecret()
+	secPlain, err := plain.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secCrypt, err := crypt.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
 	err = secPlain.SetValue(plain, totalSecret)
 	if err != nil {
 		t.Error(err)
@@ -80,7 +91,7 @@ func TestBasicWorkflow(t *testing.T) {
 		for _, i := range items {
 			var err error
 			t.Logf("item:%s\tcreated:%v\tmodified:%v\tlocked:%v\tattrs:%s\n",
-				i.GetLabel(), i.Created(), i.Modified(), i.Locked(), i.GetAttributes())
+				i.MustGetLabel(), i.MustCreated(), i.MustModified(), i.MustLocked(), i.MustGetAttributes())
 			s, err := i.GetSecret(plain)
 			if err != nil {
 				t.Error(err)
@@ -150,9 +161,9 @@ func TestService_CreateCollection(t *testing.T) {
 	}
 
 	if !dismiss {
-		for _, c := range srv.Collections() {
-			t.Logf("collection: %s\n", c.GetLabel())
-			if c.GetLabel() == "test" {
+		for _, c := range srv.MustCollections() {
+			t.Logf("collection: %s\n", c.MustGetLabel())
+			if c.MustGetLabel() == "test" {
 				return
 			}
 		}
@@ -178,7 +189,7 @@ func TestService_SearchItems(t *testing.T) {
 		for _, i := range unlocked {
 			var err error
 			t.Logf("item:%s\tcreated:%v\tmodified:%v\tlocked:%v\tattrs:%s\n",
-				i.GetLabel(), i.Created(), i.Modified(), i.Locked(), i.GetAttributes())
+				i.MustGetLabel(), i.MustCreated(), i.MustModified(), i.MustLocked(), i.MustGetAttributes())
 			s, err := i.GetSecret(session)
 			if err != nil {
 				t.Error(err)
@@ -191,3 +202,98 @@ func TestService_SearchItems(t *testing.T) {
 		}
 	}
 }
+
+type fakeGetSecrets map[dbus.ObjectPath]Secret
+
+func (f fakeGetSecrets) GetSecrets(items []dbus.ObjectPath, session dbus.ObjectPath) (map[dbus.ObjectPath]Secret, *dbus.Error) {
+	ret := make(map[dbus.ObjectPath]Secret)
+	for _, p := range items {
+		if s, ok := f[p]; ok {
+			ret[p] = s
+		}
+	}
+	return ret, nil
+}
+
+type fakeProperties map[string]dbus.Variant
+
+func (f fakeProperties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	return f, nil
+}
+
+func TestService_GetSecretValues(t *testing.T) {
+	c := selfClient(t)
+	const (
+		unlocked = dbus.ObjectPath(CollectionPath + "/fake/1")
+		locked   = dbus.ObjectPath(CollectionPath + "/fake/2")
+		missing  = dbus.ObjectPath(CollectionPath + "/fake/3")
+	)
+	secrets := fakeGetSecrets{
+		unlocked: Secret{"/", []byte{}, totalSecret, text_plain},
+	}
+	props := map[dbus.ObjectPath]fakeProperties{
+		unlocked: {
+			"Label":      dbus.MakeVariant("one"),
+			"Attributes": dbus.MakeVariant(plainAttrs),
+			"Locked":     dbus.MakeVariant(false),
+		},
+		locked: {
+			"Label":      dbus.MakeVariant("two"),
+			"Attributes": dbus.MakeVariant(cryptAttrs),
+			"Locked":     dbus.MakeVariant(true),
+		},
+	}
+	c.conn.Export(secrets, ServicePath, _Service)
+	defer c.conn.Export(nil, ServicePath, _Service)
+	for p, f := range props {
+		c.conn.Export(f, p, "org.freedesktop.DBus.Properties")
+		defer c.conn.Export(nil, p, "org.freedesktop.DBus.Properties")
+	}
+
+	items := []Item{c.Item(unlocked), c.Item(locked), c.Item(missing)}
+	res, err := c.Service().GetSecretValues(items, c.session("/", AlgoPlain, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := res[items[0]]; r.Err != nil || r.Label != "one" || !bytes.Equal(r.Value, totalSecret) {
+		t.Errorf("unlocked item: %+v", r)
+	}
+	if r := res[items[1]]; !errors.Is(r.Err, IsLocked) || r.Label != "two" {
+		t.Errorf("locked item: %+v", r)
+	}
+	if r := res[items[2]]; !errors.Is(r.Err, NoSuchObject) {
+		t.Errorf("missing item: %+v", r)
+	}
+}
+
+type fakeCreateItem struct {
+	props map[string]dbus.Variant
+}
+
+func (f *fakeCreateItem) CreateItem(props map[string]dbus.Variant, s Secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	f.props = props
+	return CollectionPath + "/fake/1", "/", nil
+}
+
+func TestCollection_CreateItemWithProperties(t *testing.T) {
+	c := selfClient(t)
+	const coll = dbus.ObjectPath(CollectionPath + "/fake")
+	f := &fakeCreateItem{}
+	c.conn.Export(f, coll, _Collection)
+	defer c.conn.Export(nil, coll, _Collection)
+
+	props := ItemProperties("label", plainAttrs)
+	props[ItemTypeProperty] = dbus.MakeVariant("org.example.Password")
+	i, err := c.Collection(coll).CreateItemWithProperties(props, Secret{"/", []byte{}, totalSecret, text_plain}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Path() != coll+"/1" {
+		t.Errorf("got item %s, want %s", i.Path(), coll+"/1")
+	}
+	for k, v := range props {
+		if got, ok := f.props[k]; !ok || got.String() != v.String() {
+			t.Errorf("%s: sent %v, want %v", k, got, v)
+		}
+	}
+}
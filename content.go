@@ -0,0 +1,132 @@
+// +build linux
+
+package ss
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// NewSecretWithContentType is NewSecret for a secret of the given MIME type,
+// e.g. ContentTypeJSON.
+func (s Session) NewSecretWithContentType(contentType string) (Secret, error) {
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		return Secret{}, fmt.Errorf("content type %q: %v", contentType, err)
+	}
+	r, err := s.NewSecret()
+	if err != nil {
+		return Secret{}, err
+	}
+	r.ContentType = contentType
+	return r, nil
+}
+
+// MediaType returns the Secret's content type without parameters, e.g.
+// "text/plain". Secrets without one are text, as the spec has it.
+func (s *Secret) MediaType() string {
+	if s.ContentType == "" {
+		return "text/plain"
+	}
+	t, _, err := mime.ParseMediaType(s.ContentType)
+	if err != nil {
+		return ""
+	}
+	return t
+}
+
+// IsText reports whether the secret is meant to be read by people: text/*,
+// JSON or PEM.
+func (s *Secret) IsText() bool {
+	switch t := s.MediaType(); {
+	case strings.HasPrefix(t, "text/"):
+		return true
+	case t == ContentTypeJSON, t == ContentTypePEM:
+		return true
+	}
+	return false
+}
+
+func (s *Secret) checkType(want string) error {
+	if t := s.MediaType(); t != want {
+		return fmt.Errorf("%q, want %q: %w", s.ContentType, want, UnknownContentType)
+	}
+	return nil
+}
+
+// SetBytes stores b as an application/octet-stream secret.
+func (s *Secret) SetBytes(session Session, b []byte) error {
+	if err := s.SetValue(session, b); err != nil {
+		return err
+	}
+	s.ContentType = ContentTypeBinary
+	return nil
+}
+
+// SetJSON stores v encoded as JSON.
+func (s *Secret) SetJSON(session Session, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := s.SetValue(session, b); err != nil {
+		return err
+	}
+	s.ContentType = ContentTypeJSON
+	return nil
+}
+
+// GetJSON decodes a JSON secret into v. Secrets of other types return
+// UnknownContentType.
+func (s *Secret) GetJSON(session Session, v interface{}) error {
+	if err := s.checkType(ContentTypeJSON); err != nil {
+		return err
+	}
+	b, err := s.GetValueBuffer(session)
+	if err != nil {
+		return err
+	}
+	defer b.Destroy()
+	return json.Unmarshal(b.Bytes(), v)
+}
+
+// SetPEM stores blocks PEM-encoded, one after another.
+func (s *Secret) SetPEM(session Session, blocks ...*pem.Block) error {
+	var b []byte
+	for _, p := range blocks {
+		b = append(b, pem.EncodeToMemory(p)...)
+	}
+	if err := s.SetValue(session, b); err != nil {
+		return err
+	}
+	s.ContentType = ContentTypePEM
+	return nil
+}
+
+// GetPEM decodes the blocks of a PEM secret. Secrets of other types return
+// UnknownContentType.
+func (s *Secret) GetPEM(session Session) ([]*pem.Block, error) {
+	if err := s.checkType(ContentTypePEM); err != nil {
+		return nil, err
+	}
+	b, err := s.GetValueBuffer(session)
+	if err != nil {
+		return nil, err
+	}
+	defer b.Destroy()
+	var ret []*pem.Block
+	rest := b.Bytes()
+	for {
+		var p *pem.Block
+		if p, rest = pem.Decode(rest); p == nil {
+			break
+		}
+		ret = append(ret, p)
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no PEM data in secret")
+	}
+	return ret, nil
+}
@@ -0,0 +1,94 @@
+package ss
+
+import (
+	"bytes"
+	"encoding/pem"
+	"errors"
+	"testing"
+)
+
+func TestContentTypes(t *testing.T) {
+	type token struct {
+		Access  string `json:"access"`
+		Expires int    `json:"expires"`
+	}
+	blocks := []*pem.Block{
+		{Type: "CERTIFICATE", Bytes: []byte{1, 2, 3}},
+		{Type: "PRIVATE KEY", Bytes: []byte{4, 5, 6}},
+	}
+	for _, ses := range []Session{plainSession, cryptSession} {
+		t.Run(ses.Algorithm, func(t *testing.T) {
+			s := Secret{Parameters: iv}
+			in := token{"abc", 3600}
+			if err := s.SetJSON(ses, in); err != nil {
+				t.Fatal(err)
+			}
+			var out token
+			if err := s.GetJSON(ses, &out); err != nil || out != in {
+				t.Errorf("JSON: got %+v, %v", out, err)
+			}
+			if _, err := s.GetPEM(ses); !errors.Is(err, UnknownContentType) {
+				t.Errorf("PEM from JSON: got %v", err)
+			}
+
+			s = Secret{Parameters: iv}
+			if err := s.SetPEM(ses, blocks...); err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.GetPEM(ses)
+			if err != nil || len(got) != len(blocks) {
+				t.Fatalf("PEM: got %v, %v", got, err)
+			}
+			for i, b := range got {
+				if b.Type != blocks[i].Type || !bytes.Equal(b.Bytes, blocks[i].Bytes) {
+					t.Errorf("PEM block %d: got %+v", i, b)
+				}
+			}
+
+			s = Secret{Parameters: iv}
+			if err := s.SetBytes(ses, []byte{0, 0xff}); err != nil {
+				t.Fatal(err)
+			}
+			if s.ContentType != ContentTypeBinary || s.IsText() {
+				t.Errorf("bytes: got %q", s.ContentType)
+			}
+			if err := s.GetJSON(ses, &out); !errors.Is(err, UnknownContentType) {
+				t.Errorf("JSON from bytes: got %v", err)
+			}
+		})
+	}
+}
+
+func TestIsText(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"":                        true,
+		text_plain:                true,
+		"text/html":               true,
+		ContentTypeJSON:           true,
+		ContentTypePEM:            true,
+		"application/json; x=y":   true,
+		ContentTypeBinary:         false,
+		"application/pkcs8":       false,
+		"not a media type; ;; = ": false,
+	} {
+		s := Secret{ContentType: ct}
+		if got := s.IsText(); got != want {
+			t.Errorf("%q: got %v, want %v", ct, got, want)
+		}
+	}
+}
+
+func TestNewSecretWithContentType(t *testing.T) {
+	c := selfClient(t)
+	ses := c.session("/org/example/session", AlgoDH, cryptSession.Key)
+	s, err := ses.NewSecretWithContentType("application/pkcs8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ContentType != "application/pkcs8" || len(s.Parameters) != 16 {
+		t.Errorf("got %+v", s)
+	}
+	if _, err := ses.NewSecretWithContentType("no/"); err == nil {
+		t.Error("bad content type accepted")
+	}
+}
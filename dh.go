@@ -0,0 +1,46 @@
+// +build linux
+
+package ss
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice/internal/dh"
+)
+
+// Where private keys come from; tests swap it for fixed ones.
+var dhRand io.Reader = rand.Reader
+
+// openDH does the client's half of the exchange described at
+// http://standards.freedesktop.org/secret-service/ch07s03.html
+func (s Service) openDH(ctx context.Context) (Session, error) {
+	grp, err := dh.Group()
+	if err != nil {
+		return Session{}, err
+	}
+	priv, err := grp.GeneratePrivateKey(dhRand)
+	if err != nil {
+		return Session{}, err
+	}
+	var reply dbus.Variant
+	var path dbus.ObjectPath
+	err = call(ctx, s.Object, _ServiceOpenSession, AlgoDH, dbus.MakeVariant(priv.Bytes())).Store(&reply, &path)
+	if err != nil {
+		return Session{}, err
+	}
+	ret := s.client.session(path, AlgoDH, nil)
+	pub, ok := reply.Value().([]byte)
+	if !ok {
+		ret.Close()
+		return Session{}, fmt.Errorf("service replied with a %s: %w", reply.Signature(), InvalidPublicKey)
+	}
+	if ret.Key, err = dh.SessionKey(grp, priv, pub); err != nil {
+		ret.Close()
+		return Session{}, err
+	}
+	return ret, nil
+}
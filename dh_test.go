@@ -0,0 +1,118 @@
+package ss
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice/internal/dh"
+	"github.com/monnand/dhkx"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The client's private and public keys for the vectors below.
+var (
+	dhClientPriv = unhex("85d7741af27f18cbefc7fdc96d4465f63d4e8da2126a196f87c4f7e1f65298855a0e4a4a8986936eae95e2b899e837c48ae39d8048f907ebd0095c87c49fb0af85d7741af27f18cbefc7fdc96d4465f63d4e8da2126a196f87c4f7e1f65298855a0e4a4a8986936eae95e2b899e837c48ae39d8048f907ebd0095c87c49fb0af")
+	dhClientPub  = unhex("18fe0877df1a84e0d06d436dfa4f399a796f8e7d09d36f176866352a49abc632ad1b541e1c473720cfac2395623dc3b284665f9c4ec49ac5006158ea606d09990f9ccbd0f6819a8a0ec625939c6e629e83b8390dc2cb4faecd03734ff26021f91a10629fe25eb7dfa259bebe9babee953b2191acb88b4266f3f617507e3e538a")
+)
+
+var dhVectors = []struct {
+	name      string
+	serverPub []byte
+	key       []byte
+}{
+	{
+		name:      "full-length",
+		serverPub: unhex("f231e84295ecdf55a22e14946571ddda8ce6c0aaa5c7fe5e063611bf65e2643f168f92728c6ea57be8d7c853ad9a7ed1a6155ffbdaf01c0369ed47438539a164717aa1adcf33a87b64c53cc7b005dbb8cf43784d921db5e49014753acd5dbe9f4c84f5d326eb66a66f4189fd2b938f2f31b787fe0a8b826906e95a189538ead6"),
+		key:       unhex("c5602ab23e562a4d01cfe503ab81e728"),
+	},
+	{
+		// The shared secret has a leading zero byte, which has to be kept.
+		name:      "padded",
+		serverPub: unhex("fa560a10131a3379b310ede1d453593f70aec6cde58eecd15dcfcb38d9de9def8999ddd7f832df9991d1b1a7b7b38bcb57f4f90a4ccfb674c81f49c1f91e236e2e270a2fa43b3d5389f241ce59a8c33e187507f1f30aa1e846e5508a449a478451aecd05e5bdc5731ac5e1041141018015eed0c32603a3f2a6d74fe9261e1a5f"),
+		key:       unhex("cb840334b2c10712386f683d11263aba"),
+	},
+}
+
+// fakeDHService answers OpenSession with a fixed reply.
+type fakeDHService struct {
+	reply dbus.Variant
+	got   []byte
+}
+
+func (f *fakeDHService) OpenSession(algo string, in dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	f.got, _ = in.Value().([]byte)
+	return f.reply, ServicePath + "/session/dh", nil
+}
+
+func TestDHVectors(t *testing.T) {
+	c := selfClient(t)
+	f := &fakeDHService{}
+	c.conn.Export(f, ServicePath, _Service)
+	defer c.conn.Export(nil, ServicePath, _Service)
+	old := dhRand
+	defer func() { dhRand = old }()
+
+	for _, v := range dhVectors {
+		t.Run(v.name, func(t *testing.T) {
+			dhRand = bytes.NewReader(dhClientPriv)
+			f.reply = dbus.MakeVariant(v.serverPub)
+			ses, err := c.Service().OpenSession(AlgoDH)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(f.got, dhClientPub) {
+				t.Errorf("sent public key %x, want %x", f.got, dhClientPub)
+			}
+			if ses.Algorithm != AlgoDH || !bytes.Equal(ses.Key, v.key) {
+				t.Errorf("got %s key %x, want %x", ses.Algorithm, ses.Key, v.key)
+			}
+		})
+	}
+}
+
+func TestDHBadReply(t *testing.T) {
+	c := selfClient(t)
+	f := &fakeDHService{}
+	c.conn.Export(f, ServicePath, _Service)
+	defer c.conn.Export(nil, ServicePath, _Service)
+
+	grp, _ := dhkx.GetGroup(2)
+	p := grp.P()
+	minus := func(n int64) []byte { return new(big.Int).Sub(p, big.NewInt(n)).Bytes() }
+	for name, reply := range map[string]dbus.Variant{
+		"string":    dbus.MakeVariant("not a key"),
+		"empty":     dbus.MakeVariant([]byte{}),
+		"zero":      dbus.MakeVariant(make([]byte, dh.KeyLen)),
+		"one":       dbus.MakeVariant([]byte{1}),
+		"p-1":       dbus.MakeVariant(minus(1)),
+		"p":         dbus.MakeVariant(p.Bytes()),
+		"too long":  dbus.MakeVariant(append([]byte{0}, minus(3)...)),
+		"too large": dbus.MakeVariant(bytes.Repeat([]byte{0xff}, dh.KeyLen)),
+	} {
+		f.reply = reply
+		_, err := c.Service().OpenSessionContext(context.Background(), AlgoDH)
+		if !errors.Is(err, InvalidPublicKey) {
+			t.Errorf("%s: got %v, want InvalidPublicKey", name, err)
+		}
+	}
+
+	// The edges of the range are fine.
+	for _, pub := range [][]byte{{2}, minus(2)} {
+		f.reply = dbus.MakeVariant(pub)
+		if _, err := c.Service().OpenSession(AlgoDH); err != nil {
+			t.Errorf("%x: %v", pub, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// +build linux
+
+package ss
+
+import (
+	"fmt"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+// Error is returned when a call on a SecretService object fails.
+//
+// Err is IsLocked, NoSuchObject, NoSession, ServiceUnknown, NoReply or
+// ServiceGone when the failure is one of those, and the underlying error
+// otherwise, so errors.Is works against the sentinels, and errors.As gets
+// at the path and D-Bus error name.
+type Error struct {
+	Path dbus.ObjectPath
+	// The D-Bus error name, if the failure came from the bus.
+	Name string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// kind is a sentinel error that also matches a broader one, e.g. NoReply
+// is a ServiceGone.
+type kind struct {
+	msg    string
+	parent error
+}
+
+func (k *kind) Error() string {
+	return k.msg
+}
+
+func (k *kind) Unwrap() error {
+	return k.parent
+}
+
+var errorNames = map[string]error{
+	"org.freedesktop.Secret.Error.IsLocked":  IsLocked,
+	"org.freedesktop.Secret.Error.NoSession": NoSession,
+
+	"org.freedesktop.Secret.Error.NoSuchObject":   NoSuchObject,
+	"org.freedesktop.DBus.Error.NoSuchObject":     NoSuchObject,
+	"org.freedesktop.DBus.Error.UnknownObject":    NoSuchObject,
+	"org.freedesktop.DBus.Error.UnknownInterface": NoSuchObject,
+
+	"org.freedesktop.DBus.Error.ServiceUnknown": ServiceUnknown,
+	"org.freedesktop.DBus.Error.NameHasNoOwner": ServiceUnknown,
+	"org.freedesktop.DBus.Error.NoReply":        NoReply,
+	"org.freedesktop.DBus.Error.Timeout":        NoReply,
+	"org.freedesktop.DBus.Error.Disconnected":   ServiceGone,
+}
+
+// wrapError turns an error from a call on path into an *Error.
+func wrapError(path dbus.ObjectPath, err error) error {
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	e := &Error{Path: path, Err: err}
+	switch de := err.(type) {
+	case dbus.Error:
+		e.Name = de.Name
+		if s, ok := errorNames[de.Name]; ok {
+			e.Err = s
+		}
+	case *dbus.Error:
+		e.Name = de.Name
+		if s, ok := errorNames[de.Name]; ok {
+			e.Err = s
+		}
+	default:
+		if err == dbus.ErrClosed {
+			e.Err = ServiceGone
+		}
+	}
+	return e
+}
+
+// wrapPropertyError is wrapError for calls on org.freedesktop.DBus.Properties.
+// Every live object has that interface, so a provider saying the method
+// doesn't exist (as GDBus does for unknown paths) means the object is gone.
+func wrapPropertyError(path dbus.ObjectPath, err error) error {
+	err = wrapError(path, err)
+	if e := err.(*Error); e.Name == "org.freedesktop.DBus.Error.UnknownMethod" {
+		e.Err = NoSuchObject
+	}
+	return err
+}
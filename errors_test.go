@@ -0,0 +1,96 @@
+package ss
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+func TestWrapError(t *testing.T) {
+	other := errors.New("other")
+	for _, c := range []struct {
+		in   error
+		want error
+	}{
+		{dbus.Error{Name: "org.freedesktop.Secret.Error.NoSuchObject"}, NoSuchObject},
+		{dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownObject"}, NoSuchObject},
+		{&dbus.Error{Name: "org.freedesktop.DBus.Error.ServiceUnknown"}, ServiceGone},
+		{dbus.Error{Name: "org.freedesktop.DBus.Error.NoReply"}, ServiceGone},
+		{dbus.ErrClosed, ServiceGone},
+		{dbus.Error{Name: "org.freedesktop.Secret.Error.IsLocked"}, IsLocked},
+		{dbus.Error{Name: "org.freedesktop.Secret.Error.NoSession"}, NoSession},
+		{dbus.Error{Name: "org.freedesktop.DBus.Error.NameHasNoOwner"}, ServiceUnknown},
+		{&dbus.Error{Name: "org.freedesktop.DBus.Error.ServiceUnknown"}, ServiceUnknown},
+		{dbus.Error{Name: "org.freedesktop.DBus.Error.NoReply"}, NoReply},
+		{other, other},
+	} {
+		err := wrapError(DefaultCollection, c.in)
+		if !errors.Is(err, c.want) {
+			t.Errorf("%v: got %v, want %v", c.in, err, c.want)
+		}
+		var e *Error
+		if !errors.As(err, &e) || e.Path != DefaultCollection {
+			t.Errorf("%v: not an *Error for %s", err, DefaultCollection)
+		}
+	}
+}
+
+func TestWrapPropertyError(t *testing.T) {
+	err := wrapPropertyError(DefaultCollection, dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod"})
+	if !errors.Is(err, NoSuchObject) {
+		t.Errorf("got %v, want %v", err, NoSuchObject)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	for _, c := range []struct {
+		err      error
+		is, isnt []error
+	}{
+		{wrapError("/", dbus.Error{Name: "org.freedesktop.DBus.Error.ServiceUnknown"}), []error{ServiceUnknown, ServiceGone}, []error{NoReply, NoSuchObject}},
+		{wrapError("/", dbus.Error{Name: "org.freedesktop.DBus.Error.NoReply"}), []error{NoReply, ServiceGone}, []error{ServiceUnknown}},
+		{wrapError("/", dbus.Error{Name: "org.freedesktop.Secret.Error.IsLocked"}), []error{IsLocked}, []error{ServiceGone, NoSuchObject}},
+		{Timeout, []error{context.DeadlineExceeded}, []error{ServiceGone}},
+	} {
+		for _, want := range c.is {
+			if !errors.Is(c.err, want) {
+				t.Errorf("%v is not %v", c.err, want)
+			}
+		}
+		for _, want := range c.isnt {
+			if errors.Is(c.err, want) {
+				t.Errorf("%v is %v", c.err, want)
+			}
+		}
+	}
+	// Wrapping twice keeps the first path.
+	err := wrapError(DefaultCollection, dbus.Error{Name: "org.freedesktop.Secret.Error.NoSession"})
+	var e *Error
+	if !errors.As(wrapError("/", err), &e) || e.Path != DefaultCollection || e.Name != "org.freedesktop.Secret.Error.NoSession" {
+		t.Errorf("got %+v", e)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	c := selfClient(t)
+	// Nothing is exported there.
+	i := c.Item(DefaultCollection + "/nothing")
+	err := i.SetLabel("x")
+	var e *Error
+	if !errors.As(err, &e) || e.Path != i.Path() || !errors.Is(err, NoSuchObject) {
+		t.Errorf("SetLabel: got %#v", err)
+	}
+	if _, err := i.GetLabel(); !errors.Is(err, NoSuchObject) {
+		t.Errorf("GetLabel: got %v", err)
+	}
+
+	gone, err := NewClient(c.Conn(), "org.example.nobody.home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gone.Service().OpenSession(AlgoDH); !errors.Is(err, ServiceUnknown) {
+		t.Errorf("OpenSession: got %v, want ServiceUnknown", err)
+	}
+}
@@ -0,0 +1,196 @@
+// +build linux
+
+package gnomekeyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// The binary format, as written by gnome-keyring's gkm-secret-binary.c.
+// Numbers are big-endian, and strings are a 32-bit length followed by the
+// bytes, with a length of 0xffffffff meaning no string.
+const (
+	binaryMagic = "GnomeKeyring\n\r\x00\n"
+
+	cryptoAES = 0
+	hashMD5   = 0
+
+	attrString = 0
+	attrUint32 = 1
+)
+
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) fail(what string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("truncated or corrupt %s", what)
+	}
+}
+
+func (r *reader) bytes(n int, what string) []byte {
+	if r.err != nil || n < 0 || len(r.b) < n {
+		r.fail(what)
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) byte(what string) byte {
+	b := r.bytes(1, what)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *reader) uint32(what string) uint32 {
+	b := r.bytes(4, what)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *reader) string(what string) []byte {
+	n := r.uint32(what)
+	if n == 0xffffffff {
+		return nil
+	}
+	if uint64(n) > uint64(len(r.b)) {
+		r.fail(what)
+		return nil
+	}
+	return r.bytes(int(n), what)
+}
+
+func (r *reader) time(what string) time.Time {
+	hi := uint64(r.uint32(what))
+	lo := uint64(r.uint32(what))
+	return time.Unix(int64(hi<<32|lo), 0)
+}
+
+func (r *reader) attributes(what string) map[string]string {
+	n := r.uint32(what)
+	ret := make(map[string]string)
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		name := string(r.string(what))
+		switch r.uint32(what) {
+		case attrString:
+			ret[name] = string(r.string(what))
+		case attrUint32:
+			ret[name] = fmt.Sprint(r.uint32(what))
+		default:
+			r.fail(what)
+		}
+	}
+	return ret
+}
+
+// deriveKey makes the AES key and IV from the password the way
+// egg_symkey_generate_simple does with SHA-256: one digest, iterated, is
+// enough for both.
+func deriveKey(password, salt []byte, iterations uint32) (key, iv []byte) {
+	h := sha256.New()
+	h.Write(password)
+	h.Write(salt)
+	d := h.Sum(nil)
+	for i := uint32(1); i < iterations; i++ {
+		s := sha256.Sum256(d)
+		d = s[:]
+	}
+	return d[:aes.BlockSize], d[aes.BlockSize : 2*aes.BlockSize]
+}
+
+func parseBinary(b, password []byte) (*Keyring, error) {
+	r := &reader{b: b[len(binaryMagic):]}
+	major, minor := r.byte("header"), r.byte("header")
+	crypto, hash := r.byte("header"), r.byte("header")
+	if r.err == nil && (major != 0 || minor != 0 || crypto != cryptoAES || hash != hashMD5) {
+		return nil, fmt.Errorf("unsupported keyring version %d.%d, crypto %d, hash %d", major, minor, crypto, hash)
+	}
+	k := &Keyring{}
+	k.Name = string(r.string("name"))
+	k.Created = r.time("header")
+	k.Modified = r.time("header")
+	k.LockOnIdle = r.uint32("header")&1 != 0
+	k.LockTimeout = r.uint32("header")
+	iterations := r.uint32("header")
+	salt := r.bytes(8, "header")
+	r.bytes(16, "header") // reserved
+	n := r.uint32("header")
+
+	// The items' IDs and types are in the clear, along with hashes of
+	// their attributes, which are of no use here.
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		id, t := r.uint32("item"), r.uint32("item")
+		r.attributes("item")
+		k.Items = append(k.Items, Item{ID: id, Type: itemType(t)})
+	}
+	size := r.uint32("encrypted data")
+	enc := r.bytes(int(size), "encrypted data")
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(enc) < md5.Size || len(enc)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted data is %d bytes", len(enc))
+	}
+	if iterations == 0 {
+		iterations = 1
+	}
+
+	key, iv := deriveKey(password, salt, iterations)
+	block, err := aes.NewCipher(key)
+	wipe(key)
+	if err != nil {
+		return nil, err
+	}
+	dec := make([]byte, len(enc))
+	// dec holds every secret; only the items' copies should outlive it.
+	defer wipe(dec)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(dec, enc)
+	sum := md5.Sum(dec[md5.Size:])
+	if subtle.ConstantTimeCompare(sum[:], dec[:md5.Size]) != 1 {
+		return nil, BadPassword
+	}
+
+	r = &reader{b: dec[md5.Size:]}
+	for i := range k.Items {
+		it := &k.Items[i]
+		it.Label = string(r.string("item"))
+		it.Secret = append([]byte{}, r.string("item")...)
+		it.Created = r.time("item")
+		it.Modified = r.time("item")
+		r.string("item") // reserved
+		r.bytes(16, "item")
+		it.Attributes = r.attributes("item")
+		// Access control lists, which gnome-keyring no longer uses.
+		acls := r.uint32("item")
+		for j := uint32(0); j < acls && r.err == nil; j++ {
+			r.uint32("item")
+			r.string("item")
+			r.string("item")
+			r.string("item")
+			r.uint32("item")
+		}
+	}
+	if r.err != nil {
+		for _, it := range k.Items {
+			wipe(it.Secret)
+		}
+		return nil, r.err
+	}
+	sortItems(k.Items)
+	return k, nil
+}
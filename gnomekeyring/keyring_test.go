@@ -0,0 +1,183 @@
+package gnomekeyring
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type writer struct{ bytes.Buffer }
+
+func (w *writer) uint32(v uint32) {
+	binary.Write(w, binary.BigEndian, v)
+}
+
+func (w *writer) string(s string) {
+	w.uint32(uint32(len(s)))
+	w.WriteString(s)
+}
+
+func (w *writer) time(t uint64) {
+	w.uint32(uint32(t >> 32))
+	w.uint32(uint32(t))
+}
+
+// binaryKeyring writes a keyring the way gkm-secret-binary.c does, with one
+// generic item holding a string and a uint32 attribute.
+func binaryKeyring(password string) []byte {
+	salt := []byte("saltsalt")
+	const iterations = 1000
+
+	w := &writer{}
+	w.WriteString(binaryMagic)
+	w.Write([]byte{0, 0, cryptoAES, hashMD5})
+	w.string("login")
+	w.time(1400000000)
+	w.time(1400000001)
+	w.uint32(1) // lock on idle
+	w.uint32(300)
+	w.uint32(iterations)
+	w.Write(salt)
+	w.Write(make([]byte, 16))
+	w.uint32(1)
+	// Hashed item info.
+	w.uint32(7)
+	w.uint32(0)
+	w.uint32(2)
+	w.string("user")
+	w.uint32(attrString)
+	w.string("0123456789abcdef")
+	w.string("port")
+	w.uint32(attrUint32)
+	w.uint32(0xdead)
+
+	p := &writer{}
+	p.string("My secret")
+	p.string("hunter2")
+	p.time(1400000002)
+	p.time(1400000003)
+	p.uint32(0xffffffff)
+	p.Write(make([]byte, 16))
+	p.uint32(2)
+	p.string("user")
+	p.uint32(attrString)
+	p.string("alice")
+	p.string("port")
+	p.uint32(attrUint32)
+	p.uint32(22)
+	p.uint32(1) // one ACL
+	p.uint32(0)
+	p.string("app")
+	p.string("/usr/bin/app")
+	p.uint32(0xffffffff)
+	p.uint32(0)
+	for (p.Len()+md5.Size)%aes.BlockSize != 0 {
+		p.WriteByte(0)
+	}
+	sum := md5.Sum(p.Bytes())
+	plain := append(sum[:], p.Bytes()...)
+
+	key, iv := deriveKey([]byte(password), salt, iterations)
+	block, _ := aes.NewCipher(key)
+	enc := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(enc, plain)
+	w.uint32(uint32(len(enc)))
+	w.Write(enc)
+	return w.Bytes()
+}
+
+func TestBinary(t *testing.T) {
+	b := binaryKeyring("pass")
+	k, err := Parse(b, []byte("pass"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Name != "login" || !k.LockOnIdle || k.LockTimeout != 300 || k.Created.Unix() != 1400000000 {
+		t.Errorf("got keyring %+v", k)
+	}
+	if len(k.Items) != 1 {
+		t.Fatalf("got %d items", len(k.Items))
+	}
+	want := map[string]string{"user": "alice", "port": "22"}
+	i := k.Items[0]
+	if i.ID != 7 || i.Label != "My secret" || string(i.Secret) != "hunter2" || !reflect.DeepEqual(i.Attributes, want) {
+		t.Errorf("got item %+v", i)
+	}
+	if i.Type != "org.freedesktop.Secret.Generic" || i.Modified.Unix() != 1400000003 {
+		t.Errorf("got type %q, modified %v", i.Type, i.Modified)
+	}
+	if got := k.Search(map[string]string{"port": "22"}); len(got) != 1 {
+		t.Errorf("Search: got %v", got)
+	}
+
+	if _, err := Parse(b, []byte("wrong")); !errors.Is(err, BadPassword) {
+		t.Errorf("wrong password: got %v", err)
+	}
+	for _, n := range []int{len(binaryMagic) + 2, len(binaryMagic) + 40, len(b) - 1} {
+		if _, err := Parse(b[:n], []byte("pass")); err == nil {
+			t.Errorf("truncated to %d bytes: expected an error", n)
+		}
+	}
+}
+
+const textual = `
+[keyring]
+display-name=Plain\sone
+ctime=1400000000
+mtime=0
+lock-on-idle=false
+lock-after=false
+
+[3]
+item-type=1
+display-name=Network\npassword
+secret=s3cr=t
+mtime=1400000005
+ctime=1400000004
+
+[3:attribute0]
+name=server
+type=string
+value=example.com
+
+[3:attribute1]
+name=port
+type=uint32
+value=443
+
+[4]
+item-type=0
+display-name=Binary
+binary-secret=00ff10
+mtime=0
+ctime=0
+`
+
+func TestTextual(t *testing.T) {
+	k, err := Parse([]byte(textual), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Name != "Plain one" || len(k.Items) != 2 {
+		t.Fatalf("got keyring %+v", k)
+	}
+	i := k.Items[0]
+	want := map[string]string{"server": "example.com", "port": "443"}
+	if i.ID != 3 || i.Label != "Network\npassword" || string(i.Secret) != "s3cr=t" || !reflect.DeepEqual(i.Attributes, want) {
+		t.Errorf("got item %+v", i)
+	}
+	if i.Type != "org.gnome.keyring.NetworkPassword" || i.Created.Unix() != 1400000004 {
+		t.Errorf("got type %q, created %v", i.Type, i.Created)
+	}
+	if s := k.Items[1].Secret; !bytes.Equal(s, []byte{0, 0xff, 0x10}) {
+		t.Errorf("got binary secret %x", s)
+	}
+	if _, err := Parse([]byte("garbage"), nil); err == nil {
+		t.Error("expected an error")
+	}
+}
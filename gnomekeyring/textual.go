@@ -0,0 +1,132 @@
+// +build linux
+
+package gnomekeyring
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The textual format, as written by gnome-keyring's gkm-secret-textual.c,
+// is a GKeyFile: a "keyring" group, a group per item named by its ID, and
+// groups named "ID:attributeN" for the item's attributes.
+
+type keyFile map[string]map[string]string
+
+func parseKeyFile(b []byte) (keyFile, error) {
+	kf := keyFile{}
+	var group map[string]string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	s.Buffer(nil, len(b)+1)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		switch {
+		case strings.TrimSpace(line) == "", strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := line[1 : len(line)-1]
+			if kf[name] == nil {
+				kf[name] = map[string]string{}
+			}
+			group = kf[name]
+		default:
+			i := strings.Index(line, "=")
+			if i < 0 || group == nil {
+				return nil, fmt.Errorf("line %d: not a key file", n)
+			}
+			group[strings.TrimSpace(line[:i])] = strings.TrimLeft(line[i+1:], " ")
+		}
+	}
+	return kf, s.Err()
+}
+
+// unescape undoes g_key_file_set_string's escaping.
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func (g keyFile) time(group, key string) time.Time {
+	n, _ := strconv.ParseInt(g[group][key], 10, 64)
+	return time.Unix(n, 0)
+}
+
+func parseTextual(b []byte) (*Keyring, error) {
+	kf, err := parseKeyFile(b)
+	if err != nil {
+		return nil, err
+	}
+	kr, ok := kf["keyring"]
+	if !ok {
+		return nil, fmt.Errorf("not a keyring file")
+	}
+	k := &Keyring{
+		Name:       unescape(kr["display-name"]),
+		Created:    kf.time("keyring", "ctime"),
+		Modified:   kf.time("keyring", "mtime"),
+		LockOnIdle: kr["lock-on-idle"] == "true",
+	}
+	if t, err := strconv.ParseUint(kr["lock-timeout"], 10, 32); err == nil {
+		k.LockTimeout = uint32(t)
+	}
+
+	for name, g := range kf {
+		id, err := strconv.ParseUint(name, 10, 32)
+		if err != nil {
+			continue
+		}
+		t, _ := strconv.ParseUint(g["item-type"], 10, 32)
+		it := Item{
+			ID:         uint32(id),
+			Type:       itemType(uint32(t)),
+			Label:      unescape(g["display-name"]),
+			Attributes: map[string]string{},
+			Created:    kf.time(name, "ctime"),
+			Modified:   kf.time(name, "mtime"),
+		}
+		if v, ok := g["binary-secret"]; ok {
+			if it.Secret, err = hex.DecodeString(v); err != nil {
+				return nil, fmt.Errorf("item %s: %v", name, err)
+			}
+		} else {
+			// Written with g_key_file_set_value, so not escaped.
+			it.Secret = []byte(g["secret"])
+		}
+		for n := 0; ; n++ {
+			a, ok := kf[fmt.Sprintf("%s:attribute%d", name, n)]
+			if !ok {
+				break
+			}
+			it.Attributes[unescape(a["name"])] = unescape(a["value"])
+		}
+		k.Items = append(k.Items, it)
+	}
+	sortItems(k.Items)
+	return k, nil
+}
@@ -0,0 +1,216 @@
+// +build linux
+
+// Package bus hands out the signals a connection receives to whoever
+// subscribed to them, for the client and the server alike.
+package bus
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+const (
+	_AddMatch    = "org.freedesktop.DBus.AddMatch"
+	_RemoveMatch = "org.freedesktop.DBus.RemoveMatch"
+)
+
+// A connection only lets a signal channel be registered, never removed, so
+// each connection gets one dispatcher that owns the channel and hands
+// signals out to whoever subscribed to them.
+var (
+	dispatchersMu sync.Mutex
+	dispatchers   = make(map[*dbus.Conn]*Dispatcher)
+)
+
+// Dispatcher owns a connection's signal channel.
+type Dispatcher struct {
+	conn *dbus.Conn
+
+	mu   sync.Mutex
+	subs map[*Subscription]bool
+}
+
+// For returns conn's Dispatcher, starting it on first use.
+func For(conn *dbus.Conn) *Dispatcher {
+	dispatchersMu.Lock()
+	defer dispatchersMu.Unlock()
+	d, ok := dispatchers[conn]
+	if !ok {
+		d = &Dispatcher{conn: conn, subs: make(map[*Subscription]bool)}
+		ch := make(chan *dbus.Signal, 16)
+		conn.Signal(ch)
+		go d.run(ch)
+		dispatchers[conn] = d
+	}
+	return d
+}
+
+// run has to keep up: the connection blocks on delivering a signal, and
+// that stalls method replies too. Subscriptions queue instead of blocking.
+func (d *Dispatcher) run(ch <-chan *dbus.Signal) {
+	for sig := range ch {
+		d.mu.Lock()
+		for s := range d.subs {
+			if s.m.matches(sig) {
+				s.push(sig)
+			}
+		}
+		d.mu.Unlock()
+	}
+	// The connection is closed.
+	dispatchersMu.Lock()
+	delete(dispatchers, d.conn)
+	dispatchersMu.Unlock()
+	d.mu.Lock()
+	for s := range d.subs {
+		delete(d.subs, s)
+		close(s.done)
+	}
+	d.mu.Unlock()
+}
+
+// Subscribe adds a match rule for m on the bus and returns a Subscription
+// receiving the signals that match it. The caller must Cancel it.
+func (d *Dispatcher) Subscribe(m Match) (*Subscription, error) {
+	c := make(chan *dbus.Signal)
+	s := &Subscription{
+		C:    c,
+		out:  c,
+		d:    d,
+		m:    m,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	d.mu.Lock()
+	d.subs[s] = true
+	d.mu.Unlock()
+	if err := d.conn.BusObject().Call(_AddMatch, 0, m.rule()).Err; err != nil {
+		d.mu.Lock()
+		delete(d.subs, s)
+		d.mu.Unlock()
+		return nil, err
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Match is a signal match rule. Empty fields match anything.
+type Match struct {
+	Sender string
+	Path   dbus.ObjectPath
+	Iface  string
+	Member string
+	// The first argument, which has to be a string.
+	Arg0 string
+}
+
+func (m Match) rule() string {
+	r := "type='signal'"
+	if m.Sender != "" {
+		r += fmt.Sprintf(",sender='%s'", m.Sender)
+	}
+	if m.Path != "" {
+		r += fmt.Sprintf(",path='%s'", m.Path)
+	}
+	if m.Iface != "" {
+		r += fmt.Sprintf(",interface='%s'", m.Iface)
+	}
+	if m.Member != "" {
+		r += fmt.Sprintf(",member='%s'", m.Member)
+	}
+	if m.Arg0 != "" {
+		r += fmt.Sprintf(",arg0='%s'", m.Arg0)
+	}
+	return r
+}
+
+// matches checks everything but the sender: signals carry the sender's
+// unique name, and the bus has already filtered on it for us.
+func (m Match) matches(sig *dbus.Signal) bool {
+	if m.Path != "" && m.Path != sig.Path {
+		return false
+	}
+	if m.Arg0 != "" {
+		if len(sig.Body) == 0 || sig.Body[0] != m.Arg0 {
+			return false
+		}
+	}
+	switch {
+	case m.Iface != "" && m.Member != "":
+		return sig.Name == m.Iface+"."+m.Member
+	case m.Iface != "":
+		return strings.HasPrefix(sig.Name, m.Iface+".")
+	case m.Member != "":
+		return strings.HasSuffix(sig.Name, "."+m.Member)
+	}
+	return true
+}
+
+// Subscription delivers matching signals on C, in order. C is closed once
+// the Subscription is cancelled or the connection goes away.
+type Subscription struct {
+	C <-chan *dbus.Signal
+
+	out chan<- *dbus.Signal
+	d   *Dispatcher
+	m   Match
+
+	mu    sync.Mutex
+	queue []*dbus.Signal
+	wake  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (s *Subscription) push(sig *dbus.Signal) {
+	s.mu.Lock()
+	s.queue = append(s.queue, sig)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) loop() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		sig := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+		select {
+		case s.out <- sig:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Cancel removes the match rule and stops delivery.
+func (s *Subscription) Cancel() {
+	s.once.Do(func() {
+		s.d.mu.Lock()
+		_, live := s.d.subs[s]
+		delete(s.d.subs, s)
+		s.d.mu.Unlock()
+		if !live {
+			// run already tore everything down.
+			return
+		}
+		close(s.done)
+		s.d.conn.BusObject().Go(_RemoveMatch, dbus.FlagNoReplyExpected, nil, s.m.rule())
+	})
+}
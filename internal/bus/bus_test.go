@@ -0,0 +1,48 @@
+package bus
+
+import (
+	"testing"
+	"time"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+func TestSubscribe(t *testing.T) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		t.Skip("no session bus")
+	}
+	const name = "org.example.bus.test"
+	sub, err := For(conn).Subscribe(Match{
+		Sender: "org.freedesktop.DBus",
+		Iface:  "org.freedesktop.DBus",
+		Member: "NameOwnerChanged",
+		Arg0:   name,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ReleaseName(name)
+	select {
+	case sig := <-sub.C:
+		if sig.Body[0] != name {
+			t.Errorf("got a signal about %v", sig.Body[0])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no signal")
+	}
+
+	sub.Cancel()
+	sub.Cancel()
+	select {
+	case _, ok := <-sub.C:
+		if ok {
+			t.Error("signal after Cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("C not closed by Cancel")
+	}
+}
@@ -0,0 +1,71 @@
+// +build linux
+
+/*
+Package dh is the key exchange of the dh-ietf1024-sha256-aes128-cbc-pkcs7
+algorithm, as described at
+http://standards.freedesktop.org/secret-service/ch07s03.html. Both the
+client and the server side use it.
+*/
+package dh
+
+import (
+	"crypto/aes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/monnand/dhkx"
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyLen is the size of public keys and the shared secret in the 1024-bit
+// group.
+const KeyLen = 128
+
+// InvalidPublicKey is returned for a peer's public key that's malformed or
+// out of range.
+var InvalidPublicKey = fmt.Errorf("invalid DH public key")
+
+// Group returns the 1024-bit MODP group the algorithm uses.
+func Group() (*dhkx.DHGroup, error) {
+	return dhkx.GetGroup(2)
+}
+
+// CheckPublicKey makes sure a peer's key is one the group allows: no longer
+// than KeyLen, and in 2..p-2, so the shared secret can't be forced to 1 or
+// p-1.
+func CheckPublicKey(grp *dhkx.DHGroup, pub []byte) error {
+	if len(pub) > KeyLen {
+		return fmt.Errorf("%d bytes long: %w", len(pub), InvalidPublicKey)
+	}
+	y := new(big.Int).SetBytes(pub)
+	max := new(big.Int).Sub(grp.P(), big.NewInt(2))
+	if y.Cmp(big.NewInt(2)) < 0 || y.Cmp(max) > 0 {
+		return fmt.Errorf("out of range: %w", InvalidPublicKey)
+	}
+	return nil
+}
+
+// SessionKey checks the peer's key, and derives the AES key: HKDF-SHA256,
+// without salt or info, of the shared secret left-padded to KeyLen bytes.
+func SessionKey(grp *dhkx.DHGroup, priv *dhkx.DHKey, pub []byte) ([]byte, error) {
+	if err := CheckPublicKey(grp, pub); err != nil {
+		return nil, err
+	}
+	shared, err := grp.ComputeKey(dhkx.NewPublicKey(pub), priv)
+	if err != nil {
+		return nil, err
+	}
+	b := shared.Bytes()
+	if len(b) > KeyLen {
+		return nil, fmt.Errorf("shared secret is %d bytes long", len(b))
+	}
+	ikm := make([]byte, KeyLen)
+	copy(ikm[KeyLen-len(b):], b)
+	key := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, nil, nil), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,62 @@
+package dh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestSessionKey(t *testing.T) {
+	grp, err := Group()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := grp.GeneratePrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := grp.GeneratePrivateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ka, err := SessionKey(grp, a, b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := SessionKey(grp, b, a.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ka, kb) || len(ka) != 16 {
+		t.Errorf("keys differ: %x and %x", ka, kb)
+	}
+}
+
+func TestCheckPublicKey(t *testing.T) {
+	grp, err := Group()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := grp.P()
+	for name, pub := range map[string][]byte{
+		"zero":     {0},
+		"one":      {1},
+		"p-1":      new(big.Int).Sub(p, big.NewInt(1)).Bytes(),
+		"p":        p.Bytes(),
+		"too long": append([]byte{0}, p.Bytes()...),
+	} {
+		if err := CheckPublicKey(grp, pub); !errors.Is(err, InvalidPublicKey) {
+			t.Errorf("%s: got %v, want InvalidPublicKey", name, err)
+		}
+	}
+	for name, pub := range map[string][]byte{
+		"two": {2},
+		"p-2": new(big.Int).Sub(p, big.NewInt(2)).Bytes(),
+	} {
+		if err := CheckPublicKey(grp, pub); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// +build linux
+
+/*
+Package keyring is a small password store on top of the SecretService API.
+
+Items are stored the way zalando/go-keyring and Python's keyring library
+store them, with "service" and "username" attributes, so passwords set by
+any of them can be read by the others.
+*/
+package keyring
+
+import (
+	"fmt"
+
+	"github.com/hdonnay/secretservice"
+)
+
+const loginCollection = ss.CollectionPath + "/login"
+
+// python-keyring tags what it stores with this, and replaces items by all
+// their attributes, so Set tags them the same way. Lookups leave it out,
+// as go-keyring doesn't set it.
+const application = "Python keyring library"
+
+// ErrNotFound is returned by Get and Delete when no password is stored.
+var ErrNotFound = fmt.Errorf("secret not found in keyring")
+
+// The schema secretstorage (and so python-keyring) records. Searches don't
+// match on it, because go-keyring doesn't set it.
+var schema = ss.Schema{
+	Name:  "org.freedesktop.Secret.Generic",
+	Flags: ss.SchemaDontMatchName,
+	Attributes: map[string]ss.AttributeType{
+		"service":     ss.AttributeString,
+		"username":    ss.AttributeString,
+		"application": ss.AttributeString,
+	},
+}
+
+func attributes(service, user string) map[string]interface{} {
+	return map[string]interface{}{
+		"service":  service,
+		"username": user,
+	}
+}
+
+// Set stores password for user on service, replacing any previous one.
+func Set(service, user, password string) error {
+	srv, err := ss.DialService()
+	if err != nil {
+		return err
+	}
+	c, err := collection(srv)
+	if err != nil {
+		return err
+	}
+	label := fmt.Sprintf("Password for '%s' on '%s'", user, service)
+	attrs := attributes(service, user)
+	attrs["application"] = application
+	return srv.PasswordStore(schema, c, label, password, attrs)
+}
+
+// Get returns the password stored for user on service.
+func Get(service, user string) (string, error) {
+	srv, err := ss.DialService()
+	if err != nil {
+		return "", err
+	}
+	p, err := srv.PasswordLookup(schema, attributes(service, user))
+	if err == ss.NotFound {
+		return "", ErrNotFound
+	}
+	return p, err
+}
+
+// Delete removes the password stored for user on service.
+func Delete(service, user string) error {
+	srv, err := ss.DialService()
+	if err != nil {
+		return err
+	}
+	ok, err := srv.PasswordClear(schema, attributes(service, user))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Passwords go in the "default" alias, like python-keyring. If there isn't
+// one, go-keyring's choice of the login collection is used, and if that's
+// missing too, the default collection is created.
+func collection(srv ss.Service) (string, error) {
+	c, err := srv.ReadAlias("default")
+	if err != nil {
+		return "", err
+	}
+	if c.Path() != "/" {
+		return string(c.Path()), nil
+	}
+	cs, err := srv.Collections()
+	if err != nil {
+		return "", err
+	}
+	for _, c := range cs {
+		if string(c.Path()) == loginCollection {
+			return loginCollection, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,68 @@
+package keyring
+
+import (
+	"testing"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/sstest"
+)
+
+func TestKeyring(t *testing.T) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		t.Skip("no session bus")
+	}
+	reply, err := conn.RequestName(ss.ServiceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Skip("a secret service is already running")
+	}
+	defer conn.ReleaseName(ss.ServiceName)
+	srv, err := sstest.NewServer(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	if _, err := Get("svc", "alice"); err != ErrNotFound {
+		t.Errorf("Get before Set: got %v", err)
+	}
+	if err := Set("svc", "alice", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set("svc", "alice", "hunter3"); err != nil {
+		t.Fatal(err)
+	}
+	if p, err := Get("svc", "alice"); err != nil || p != "hunter3" {
+		t.Errorf("Get: got %q, %v", p, err)
+	}
+
+	// Items written by go-keyring carry no schema.
+	c, err := srv.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := c.Collection(sstest.LoginCollection).Items()
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Items: got %v, %v", items, err)
+	}
+	if attrs, _ := items[0].GetAttributes(); attrs["application"] != application {
+		t.Errorf("got attributes %v", attrs)
+	}
+	if err := items[0].SetAttributes(map[string]string{"service": "svc", "username": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if l, _ := items[0].GetLabel(); l != "Password for 'alice' on 'svc'" {
+		t.Errorf("got label %q", l)
+	}
+	if p, err := Get("svc", "alice"); err != nil || p != "hunter3" {
+		t.Errorf("Get without schema: got %q, %v", p, err)
+	}
+
+	if err := Delete("svc", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Delete("svc", "alice"); err != ErrNotFound {
+		t.Errorf("second Delete: got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+// +build linux
+
+package ss
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice/internal/bus"
+)
+
+const (
+	_DBusName      = "org.freedesktop.DBus"
+	_DBusPath      = "/org/freedesktop/DBus"
+	_GetNameOwner  = "org.freedesktop.DBus.GetNameOwner"
+	nameHasNoOwner = "org.freedesktop.DBus.Error.NameHasNoOwner"
+	nameOwnerEvent = "NameOwnerChanged"
+)
+
+// SessionManager keeps a Session open with whoever owns the Client's bus
+// name, for programs that outlive the service, e.g. a gnome-keyring that
+// gets restarted.
+//
+// When the owner changes, the old Session is wiped and a new one is
+// negotiated. Sessions, Collections, Items and Prompts got before then
+// belong to the old owner: Invalidated says when to look them up again.
+type SessionManager struct {
+	s   Service
+	sub *bus.Subscription
+	// Held while negotiating, so callers wait on one exchange instead of
+	// each doing their own.
+	opening chan struct{}
+
+	mu          sync.Mutex
+	owner       string
+	ses         *Session
+	invalidated chan struct{}
+	closed      bool
+}
+
+// NewSessionManager starts watching the owner of s's bus name. Sessions are
+// opened with NegotiateSession, so the Client's SessionPolicy holds.
+func NewSessionManager(s Service) (*SessionManager, error) {
+	m := &SessionManager{
+		s:           s,
+		opening:     make(chan struct{}, 1),
+		invalidated: make(chan struct{}),
+	}
+	var err error
+	m.sub, err = bus.For(s.client.conn).Subscribe(bus.Match{
+		Sender: _DBusName,
+		Path:   _DBusPath,
+		Iface:  _DBusName,
+		Member: nameOwnerEvent,
+		Arg0:   s.client.name,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Subscribed first, so a change can't slip in between.
+	err = call(context.Background(), s.client.conn.BusObject(), _GetNameOwner, s.client.name).Store(&m.owner)
+	var e *Error
+	if err != nil && !(errors.As(err, &e) && e.Name == nameHasNoOwner) {
+		m.sub.Cancel()
+		return nil, err
+	}
+	go m.watch()
+	return m, nil
+}
+
+func (m *SessionManager) watch() {
+	for sig := range m.sub.C {
+		var name, old, owner string
+		if err := dbus.Store(sig.Body, &name, &old, &owner); err != nil {
+			continue
+		}
+		m.mu.Lock()
+		if owner == m.owner {
+			m.mu.Unlock()
+			continue
+		}
+		m.owner = owner
+		m.invalidate()
+		m.mu.Unlock()
+		if owner != "" {
+			// Reopen right away, so a later Session call doesn't
+			// have to wait on the exchange. Failing is fine here;
+			// Session tries again.
+			go m.SessionContext(context.Background())
+		}
+	}
+}
+
+// invalidate drops the session. It expects m.mu to be held.
+func (m *SessionManager) invalidate() {
+	if m.ses != nil {
+		// The old owner is gone, or no longer ours: Close would go
+		// to the new one, so only forget the key.
+		Wipe(m.ses.Key)
+		m.ses = nil
+	}
+	close(m.invalidated)
+	m.invalidated = make(chan struct{})
+}
+
+// Session returns the open Session, negotiating a new one if the owner
+// changed since the last. Each caller gets its own copy of the key, so
+// the manager wiping its own doesn't pull it from under a decrypt in
+// flight; callers may Wipe theirs once done, but shouldn't Close the
+// Session.
+func (m *SessionManager) Session() (Session, error) {
+	return m.SessionContext(context.Background())
+}
+
+func (m *SessionManager) SessionContext(ctx context.Context) (Session, error) {
+	select {
+	case m.opening <- struct{}{}:
+		defer func() { <-m.opening }()
+	case <-ctx.Done():
+		return Session{}, ctx.Err()
+	}
+	for {
+		m.mu.Lock()
+		switch {
+		case m.closed:
+			m.mu.Unlock()
+			return Session{}, InvalidSession
+		case m.ses != nil:
+			ses := m.ses.copy()
+			m.mu.Unlock()
+			return ses, nil
+		}
+		owner := m.owner
+		m.mu.Unlock()
+
+		ses, err := m.s.NegotiateSessionContext(ctx)
+		if err != nil {
+			return Session{}, err
+		}
+		m.mu.Lock()
+		if !m.closed && m.owner == owner {
+			m.ses = &ses
+			m.mu.Unlock()
+			return ses.copy(), nil
+		}
+		closed := m.closed
+		m.mu.Unlock()
+		if closed {
+			ses.Close()
+			return Session{}, InvalidSession
+		}
+		// Opened with an owner that's gone already; as in invalidate,
+		// Close would hit the wrong one.
+		Wipe(ses.Key)
+	}
+}
+
+// copy returns s with a key of its own.
+func (s Session) copy() Session {
+	s.Key = append([]byte(nil), s.Key...)
+	return s
+}
+
+// Owner returns the unique bus name of the service's current owner, or ""
+// if nothing owns it.
+func (m *SessionManager) Owner() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.owner
+}
+
+// Invalidated returns a channel that's closed when the owner next changes.
+// Every object got before then is stale once it is.
+func (m *SessionManager) Invalidated() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.invalidated
+}
+
+// Close stops watching and closes the Session.
+func (m *SessionManager) Close() {
+	m.sub.Cancel()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	m.closed = true
+	if m.ses != nil {
+		m.ses.Close()
+		m.ses = nil
+	}
+}
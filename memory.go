@@ -0,0 +1,138 @@
+// +build linux
+
+package ss
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/vgorin/cryptogo/pad"
+)
+
+// Not in package syscall.
+const madvDontDump = 16
+
+// Buffer is memory for a secret, kept off the Go heap so the garbage
+// collector never copies it. It's locked into RAM if RLIMIT_MEMLOCK allows,
+// and left out of core dumps. Destroy wipes it.
+type Buffer struct {
+	mem    []byte
+	n      int
+	locked bool
+}
+
+// NewBuffer returns a zeroed Buffer of n bytes.
+func NewBuffer(n int) (*Buffer, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("negative buffer size %d", n)
+	}
+	// Mappings can't be empty, and are whole pages anyway.
+	size, page := n, os.Getpagesize()
+	if size == 0 {
+		size = 1
+	}
+	size = (size + page - 1) &^ (page - 1)
+	mem, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Madvise(mem, madvDontDump); err != nil {
+		syscall.Munmap(mem)
+		return nil, err
+	}
+	b := &Buffer{mem: mem, n: n}
+	// Unprivileged processes only get a little locked memory; a Buffer
+	// that doesn't fit is still kept out of dumps.
+	b.locked = syscall.Mlock(mem) == nil
+	return b, nil
+}
+
+// Bytes returns the Buffer's contents. The slice is only valid until
+// Destroy.
+func (b *Buffer) Bytes() []byte {
+	return b.mem[:b.n]
+}
+
+// Len returns the size of the Buffer.
+func (b *Buffer) Len() int {
+	return b.n
+}
+
+// Locked reports whether the Buffer is locked into RAM, i.e. will never be
+// written to swap.
+func (b *Buffer) Locked() bool {
+	return b.locked
+}
+
+// Destroy zeroes and frees the Buffer. It's safe to call more than once.
+func (b *Buffer) Destroy() {
+	if b.mem == nil {
+		return
+	}
+	Wipe(b.mem)
+	if b.locked {
+		syscall.Munlock(b.mem)
+	}
+	syscall.Munmap(b.mem)
+	b.mem, b.n, b.locked = nil, 0, false
+}
+
+// Wipe zeroes b.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// GetValueBuffer is GetValue, but decrypts into a Buffer, and wipes every
+// copy of the secret it makes on the way. The caller has to Destroy it.
+func (s *Secret) GetValueBuffer(session Session) (*Buffer, error) {
+	switch session.Algorithm {
+	case AlgoPlain:
+		b, err := NewBuffer(len(s.Value))
+		if err != nil {
+			return nil, err
+		}
+		copy(b.Bytes(), s.Value)
+		return b, nil
+	case AlgoDH:
+		block, err := aes.NewCipher(session.Key)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkCiphertext(); err != nil {
+			return nil, err
+		}
+		b, err := NewBuffer(len(s.Value))
+		if err != nil {
+			return nil, err
+		}
+		cipher.NewCBCDecrypter(block, s.Parameters).CryptBlocks(b.Bytes(), s.Value)
+		plain, err := pad.PKCS7Unpad(b.Bytes())
+		if err != nil {
+			b.Destroy()
+			return nil, err
+		}
+		Wipe(b.mem[len(plain):])
+		b.n = len(plain)
+		return b, nil
+	default:
+		return nil, InvalidSession
+	}
+}
+
+// DisableCoreDumps keeps the process from dumping core, and other processes
+// of the same user from attaching to it, so secrets it reads can't end up
+// on disk that way.
+func DisableCoreDumps() error {
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{}); err != nil {
+		return err
+	}
+	if _, _, e := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_DUMPABLE, 0, 0); e != 0 {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package ss
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	for _, n := range []int{0, 1, 4096, 5000} {
+		b, err := NewBuffer(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Len() != n || len(b.Bytes()) != n {
+			t.Errorf("%d: got %d bytes", n, b.Len())
+		}
+		if !bytes.Equal(b.Bytes(), make([]byte, n)) {
+			t.Errorf("%d: not zeroed", n)
+		}
+		copy(b.Bytes(), "hunter2")
+		t.Logf("%d: locked %v", n, b.Locked())
+		b.Destroy()
+		b.Destroy()
+		if b.Len() != 0 || b.Bytes() != nil {
+			t.Errorf("%d: %d bytes left after Destroy", n, b.Len())
+		}
+	}
+	if _, err := NewBuffer(-1); err == nil {
+		t.Error("negative size accepted")
+	}
+}
+
+func TestGetValueBuffer(t *testing.T) {
+	for _, p := range plainTest {
+		b, err := p.out.GetValueBuffer(plainSession)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Bytes(), p.in) {
+			t.Errorf("got %q, want %q", b.Bytes(), p.in)
+		}
+		b.Destroy()
+	}
+	for _, p := range cryptTest {
+		p.out.Parameters = iv
+		b, err := p.out.GetValueBuffer(cryptSession)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b.Bytes(), p.in) {
+			t.Errorf("got %q, want %q", b.Bytes(), p.in)
+		}
+		// The padding is gone, not just hidden.
+		if tail := b.mem[b.Len():len(p.out.Value)]; !bytes.Equal(tail, make([]byte, len(tail))) {
+			t.Errorf("padding left: %x", tail)
+		}
+		b.Destroy()
+	}
+	bad := Secret{"/", iv, []byte("short"), text_plain}
+	if _, err := bad.GetValueBuffer(cryptSession); err == nil {
+		t.Error("short ciphertext accepted")
+	}
+	if _, err := bad.GetValueBuffer(Session{}); err != InvalidSession {
+		t.Errorf("got %v, want InvalidSession", err)
+	}
+}
+
+func TestSetValueKeepsSecret(t *testing.T) {
+	// Room for the padding to be appended in place.
+	secret := make([]byte, 4, aes.BlockSize)
+	copy(secret, "test")
+	var s Secret
+	s.Parameters = iv
+	if err := s.SetValue(cryptSession, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret) != "test" {
+		t.Errorf("secret wiped: %q", secret)
+	}
+}
+
+func TestSessionCloseWipesKey(t *testing.T) {
+	c := selfClient(t)
+	ses := c.session("/org/example/session", AlgoDH, bytes.Repeat([]byte{44}, 16))
+	cp := ses
+	ses.Close()
+	if !bytes.Equal(cp.Key, make([]byte, 16)) {
+		t.Errorf("key not wiped: %x", cp.Key)
+	}
+}
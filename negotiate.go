@@ -0,0 +1,62 @@
+// +build linux
+
+package ss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SessionPolicy decides which session algorithms a Client may use. Whatever
+// the policy, NegotiateSession tries AlgoDH first; the chosen algorithm is
+// the returned Session's Algorithm.
+type SessionPolicy int
+
+const (
+	// NegotiateSession only opens AlgoDH sessions. Asking OpenSession for
+	// AlgoPlain by name still works.
+	RequireEncryption SessionPolicy = iota
+	// NegotiateSession falls back to AlgoPlain if the service doesn't
+	// support AlgoDH.
+	AllowPlain
+	// No AlgoPlain session is ever opened, not even by OpenSession.
+	ForbidPlain
+)
+
+func (p SessionPolicy) String() string {
+	switch p {
+	case RequireEncryption:
+		return "require-encryption"
+	case AllowPlain:
+		return "allow-plain"
+	case ForbidPlain:
+		return "forbid-plain"
+	}
+	return fmt.Sprintf("SessionPolicy(%d)", int(p))
+}
+
+// NegotiateSession opens the best session the service and the Client's
+// SessionPolicy agree on. Secrets are only ever sent in the clear if the
+// policy is AllowPlain and the service can't do AlgoDH.
+func (s Service) NegotiateSession() (Session, error) {
+	return s.NegotiateSessionContext(context.Background())
+}
+
+func (s Service) NegotiateSessionContext(ctx context.Context) (Session, error) {
+	ses, err := s.OpenSessionContext(ctx, AlgoDH)
+	if err == nil || !unsupportedAlgorithm(err) {
+		return ses, err
+	}
+	if s.client.SessionPolicy != AllowPlain {
+		return Session{}, fmt.Errorf("service doesn't support %s, and %v: %w", AlgoDH, s.client.SessionPolicy, PlainForbidden)
+	}
+	return s.OpenSessionContext(ctx, AlgoPlain)
+}
+
+// Providers answer OpenSession with NotSupported for algorithms they don't
+// know.
+func unsupportedAlgorithm(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Name == "org.freedesktop.DBus.Error.NotSupported"
+}
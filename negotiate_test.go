@@ -0,0 +1,51 @@
+package ss
+
+import (
+	"errors"
+	"testing"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+// fakePlainService only knows AlgoPlain, like an old or minimal provider.
+type fakePlainService struct {
+	opened []string
+}
+
+func (f *fakePlainService) OpenSession(algo string, in dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algo != AlgoPlain {
+		return dbus.MakeVariant(""), "/", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []interface{}{"no " + algo})
+	}
+	f.opened = append(f.opened, algo)
+	return dbus.MakeVariant(""), ServicePath + "/session/plain", nil
+}
+
+func TestNegotiateSession(t *testing.T) {
+	c := selfClient(t)
+	f := &fakePlainService{}
+	c.conn.Export(f, ServicePath, _Service)
+	defer c.conn.Export(nil, ServicePath, _Service)
+	defer func() { c.SessionPolicy = RequireEncryption }()
+
+	for _, p := range []SessionPolicy{RequireEncryption, ForbidPlain} {
+		c.SessionPolicy = p
+		if _, err := c.Service().NegotiateSession(); !errors.Is(err, PlainForbidden) {
+			t.Errorf("%v: got %v, want PlainForbidden", p, err)
+		}
+	}
+	if _, err := c.Service().OpenSession(AlgoPlain); err != PlainForbidden {
+		t.Errorf("OpenSession with %v: got %v", ForbidPlain, err)
+	}
+	if len(f.opened) != 0 {
+		t.Fatalf("opened %v", f.opened)
+	}
+
+	c.SessionPolicy = AllowPlain
+	ses, err := c.Service().NegotiateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ses.Algorithm != AlgoPlain || len(f.opened) != 1 {
+		t.Errorf("negotiated %q, opened %v", ses.Algorithm, f.opened)
+	}
+}
@@ -0,0 +1,102 @@
+// +build linux
+
+package ss
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+// A Prompter decides what happens when a method call needs the user to
+// confirm something: whether a prompt is shown at all, which window it is
+// attached to, how long it may stay up and what a dismissal means.
+//
+// Prompt is called with each Prompt the service hands back, and what it
+// returns is used as the prompt's outcome.
+type Prompter interface {
+	Prompt(ctx context.Context, p Prompt) (dbus.Variant, error)
+}
+
+// PromptFunc adapts a function to the Prompter interface.
+type PromptFunc func(ctx context.Context, p Prompt) (dbus.Variant, error)
+
+func (f PromptFunc) Prompt(ctx context.Context, p Prompt) (dbus.Variant, error) {
+	return f(ctx, p)
+}
+
+// AlwaysPrompt shows every prompt. It's what a Client uses when its
+// Prompter is nil.
+type AlwaysPrompt struct {
+	// Passed to the service so it can attach its dialog to the caller's
+	// window. If empty, WindowIDFromEnv is used.
+	WindowID string
+	// How long a prompt may stay up if the context has no deadline. Zero
+	// means one minute, negative means no limit. A prompt that times out
+	// is dismissed and returns Timeout.
+	Timeout time.Duration
+	// If set, called when the user dismisses the prompt; its error is
+	// returned in place of PromptDismissed.
+	OnDismiss func(p Prompt) error
+}
+
+func (a AlwaysPrompt) Prompt(ctx context.Context, p Prompt) (dbus.Variant, error) {
+	window := a.WindowID
+	if window == "" {
+		window = WindowIDFromEnv()
+	}
+	timeout := a.Timeout
+	if timeout == 0 {
+		timeout = promptTimeout
+	}
+	pctx := ctx
+	if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+		var cancel context.CancelFunc
+		pctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	v, err := p.PromptContext(pctx, window)
+	switch {
+	case err == context.DeadlineExceeded && ctx.Err() == nil:
+		err = Timeout
+	case err == PromptDismissed && a.OnDismiss != nil:
+		err = a.OnDismiss(p)
+	}
+	return v, err
+}
+
+// NeverPrompt refuses every prompt with PromptRequired, for headless
+// daemons where nobody would ever answer one.
+type NeverPrompt struct{}
+
+func (NeverPrompt) Prompt(ctx context.Context, p Prompt) (dbus.Variant, error) {
+	// Tidy up the service's side; nobody is going to show it.
+	p.abandon()
+	return dbus.Variant{}, PromptRequired
+}
+
+// WindowIDFromEnv returns the window handle to attach prompts to, as given
+// by the environment: $SECRET_SERVICE_WINDOW_ID, verbatim, so a launcher can
+// pass any handle the provider understands (an xdg-foreign handle as
+// "wayland:HANDLE", for example), or else the X11 window id in $WINDOWID,
+// which most X terminal emulators set. It returns "" if neither is set.
+func WindowIDFromEnv() string {
+	if id := os.Getenv("SECRET_SERVICE_WINDOW_ID"); id != "" {
+		return id
+	}
+	return os.Getenv("WINDOWID")
+}
+
+// X11Window formats an X11 window id as a window handle.
+func X11Window(xid uint32) string {
+	return fmt.Sprint(xid)
+}
+
+// WaylandWindow formats a handle exported through xdg-foreign as a window
+// handle.
+func WaylandWindow(handle string) string {
+	return "wayland:" + handle
+}
@@ -0,0 +1,69 @@
+package ss
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+func TestPrompters(t *testing.T) {
+	c := selfClient(t)
+	ctx := context.Background()
+	f := &_FakePrompt{conn: c.conn, path: fake, result: "done", window: make(chan string, 1)}
+	exportPrompt(t, f)
+	defer c.conn.Export(nil, fake, _Prompt)
+
+	c.Prompter = AlwaysPrompt{WindowID: X11Window(42)}
+	if _, err := c.checkPrompt(ctx, fake); err != nil {
+		t.Fatal(err)
+	}
+	if w := <-f.window; w != "42" {
+		t.Errorf("prompt shown for window %q, want %q", w, "42")
+	}
+
+	errDenied := errors.New("denied")
+	f.dismiss = true
+	c.Prompter = AlwaysPrompt{OnDismiss: func(Prompt) error { return errDenied }}
+	if _, err := c.checkPrompt(ctx, fake); err != errDenied {
+		t.Errorf("got %v, want %v", err, errDenied)
+	}
+	<-f.window
+
+	c.Prompter = NeverPrompt{}
+	if _, err := c.checkPrompt(ctx, fake); err != PromptRequired {
+		t.Errorf("got %v, want %v", err, PromptRequired)
+	}
+	select {
+	case <-f.window:
+		t.Error("NeverPrompt showed the prompt")
+	default:
+	}
+
+	var called dbus.ObjectPath
+	c.Prompter = PromptFunc(func(ctx context.Context, p Prompt) (dbus.Variant, error) {
+		called = p.Path()
+		return dbus.MakeVariant("func"), nil
+	})
+	v, err := c.checkPrompt(ctx, fake)
+	if err != nil || v.Value() != "func" || called != fake {
+		t.Errorf("PromptFunc: got %v, %v for %q", v.Value(), err, called)
+	}
+}
+
+func TestWindowIDFromEnv(t *testing.T) {
+	defer os.Setenv("SECRET_SERVICE_WINDOW_ID", os.Getenv("SECRET_SERVICE_WINDOW_ID"))
+	defer os.Setenv("WINDOWID", os.Getenv("WINDOWID"))
+
+	os.Setenv("SECRET_SERVICE_WINDOW_ID", "")
+	os.Setenv("WINDOWID", "1234")
+	if id := WindowIDFromEnv(); id != "1234" {
+		t.Errorf("got %q, want WINDOWID", id)
+	}
+	os.Setenv("SECRET_SERVICE_WINDOW_ID", WaylandWindow("abc"))
+	if id := WindowIDFromEnv(); id != "wayland:abc" {
+		t.Errorf("got %q, want SECRET_SERVICE_WINDOW_ID", id)
+	}
+}
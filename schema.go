@@ -0,0 +1,310 @@
+// +build linux
+
+package ss
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+// The attribute libsecret records a Schema's name under.
+const SchemaAttribute = "xdg:schema"
+
+// AttributeType is the type a Schema declares for an attribute. The values
+// match libsecret's SecretSchemaAttributeType.
+type AttributeType int
+
+const (
+	AttributeString AttributeType = iota
+	AttributeInteger
+	AttributeBoolean
+)
+
+func (t AttributeType) String() string {
+	switch t {
+	case AttributeString:
+		return "string"
+	case AttributeInteger:
+		return "integer"
+	case AttributeBoolean:
+		return "boolean"
+	}
+	return fmt.Sprintf("AttributeType(%d)", int(t))
+}
+
+// SchemaFlags match libsecret's SecretSchemaFlags.
+type SchemaFlags int
+
+const (
+	SchemaNone SchemaFlags = 0
+	// Don't add SchemaAttribute when searching, so items stored by
+	// applications that don't record a schema still match.
+	SchemaDontMatchName SchemaFlags = 1 << 1
+)
+
+// Schema describes the attributes of a kind of item, the same way a
+// libsecret SecretSchema does, so items can be shared with C and Python
+// applications.
+type Schema struct {
+	Name       string
+	Flags      SchemaFlags
+	Attributes map[string]AttributeType
+}
+
+// Encode validates attrs against the schema and returns them the way
+// libsecret stores them: strings as-is, integers in decimal, and booleans
+// as "true" or "false".
+//
+// Values may be given as Go strings, integers or booleans. Strings are
+// accepted for every type, but have to parse as the declared type.
+func (sc Schema) Encode(attrs map[string]interface{}) (map[string]string, error) {
+	ret := make(map[string]string, len(attrs))
+	for k, v := range attrs {
+		if k == SchemaAttribute {
+			s, ok := v.(string)
+			if !ok || s != sc.Name {
+				return nil, fmt.Errorf("schema %s: %s doesn't match the schema name", sc.Name, k)
+			}
+			continue
+		}
+		t, ok := sc.Attributes[k]
+		if !ok {
+			return nil, fmt.Errorf("schema %s: attribute %q is not in the schema", sc.Name, k)
+		}
+		s, err := encodeAttribute(t, v)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: attribute %q: %v", sc.Name, k, err)
+		}
+		ret[k] = s
+	}
+	return ret, nil
+}
+
+func encodeAttribute(t AttributeType, v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	switch t {
+	case AttributeString:
+		if rv.Kind() == reflect.String {
+			return rv.String(), nil
+		}
+	case AttributeInteger:
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return strconv.FormatInt(rv.Int(), 10), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return strconv.FormatUint(rv.Uint(), 10), nil
+		case reflect.String:
+			if _, err := strconv.ParseInt(rv.String(), 10, 64); err != nil {
+				return "", fmt.Errorf("%q is not an integer", rv.String())
+			}
+			return rv.String(), nil
+		}
+	case AttributeBoolean:
+		switch rv.Kind() {
+		case reflect.Bool:
+			return strconv.FormatBool(rv.Bool()), nil
+		case reflect.String:
+			if s := rv.String(); s != "true" && s != "false" {
+				return "", fmt.Errorf("%q is not a boolean", s)
+			}
+			return rv.String(), nil
+		}
+	default:
+		return "", fmt.Errorf("unknown type %v", t)
+	}
+	return "", fmt.Errorf("%T can't be used as %v", v, t)
+}
+
+// StoreAttributes encodes attrs and adds SchemaAttribute, as libsecret does
+// when storing an item.
+func (sc Schema) StoreAttributes(attrs map[string]interface{}) (map[string]string, error) {
+	ret, err := sc.Encode(attrs)
+	if err != nil {
+		return nil, err
+	}
+	ret[SchemaAttribute] = sc.Name
+	return ret, nil
+}
+
+// SearchAttributes encodes attrs and adds SchemaAttribute, unless the schema
+// has SchemaDontMatchName. Without attrs, that searches for every item of the
+// schema; with SchemaDontMatchName, at least one attribute is required, as
+// in libsecret, so a search can't match every item by accident.
+func (sc Schema) SearchAttributes(attrs map[string]interface{}) (map[string]string, error) {
+	ret, err := sc.Encode(attrs)
+	if err != nil {
+		return nil, err
+	}
+	if sc.Flags&SchemaDontMatchName != 0 {
+		if len(ret) == 0 {
+			return nil, fmt.Errorf("schema %s: at least one attribute is required to match", sc.Name)
+		}
+	} else {
+		ret[SchemaAttribute] = sc.Name
+	}
+	return ret, nil
+}
+
+// PasswordStore stores password in an item with the passed label and
+// attributes, replacing any item with the same attributes.
+//
+// The collection may be an alias or an object path. An empty string means
+// the "default" alias, which is created if no collection has it yet.
+//
+// The Password helpers open their sessions with NegotiateSession, so they
+// follow the Client's SessionPolicy.
+func (s Service) PasswordStore(sc Schema, collection, label, password string, attrs map[string]interface{}) error {
+	return s.PasswordStoreContext(context.Background(), sc, collection, label, password, attrs)
+}
+
+func (s Service) PasswordStoreContext(ctx context.Context, sc Schema, collection, label, password string, attrs map[string]interface{}) error {
+	a, err := sc.StoreAttributes(attrs)
+	if err != nil {
+		return err
+	}
+	c, err := s.passwordCollection(ctx, collection)
+	if err != nil {
+		return err
+	}
+	ses, err := s.NegotiateSessionContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer ses.Close()
+	sec, err := ses.NewSecret()
+	if err != nil {
+		return err
+	}
+	if err := sec.SetValue(ses, []byte(password)); err != nil {
+		return err
+	}
+	prop := ItemProperties(label, a)
+	prop[ItemTypeProperty] = dbus.MakeVariant(sc.Name)
+	_, err = c.CreateItemWithPropertiesContext(ctx, prop, sec, true)
+	return err
+}
+
+// PasswordLookup returns the password of the first item matching attrs,
+// unlocking it if needed. NotFound is returned if nothing matches.
+func (s Service) PasswordLookup(sc Schema, attrs map[string]interface{}) (string, error) {
+	return s.PasswordLookupContext(context.Background(), sc, attrs)
+}
+
+func (s Service) PasswordLookupContext(ctx context.Context, sc Schema, attrs map[string]interface{}) (string, error) {
+	a, err := sc.SearchAttributes(attrs)
+	if err != nil {
+		return "", err
+	}
+	unlocked, locked, err := s.SearchItemsContext(ctx, a)
+	if err != nil {
+		return "", err
+	}
+	var i Item
+	switch {
+	case len(unlocked) != 0:
+		i = unlocked[0]
+	case len(locked) != 0:
+		i = locked[0]
+		done, err := s.UnlockContext(ctx, []Object{i})
+		if err != nil {
+			return "", err
+		}
+		if len(done) == 0 {
+			return "", &Error{Path: i.Path(), Err: IsLocked}
+		}
+	default:
+		return "", NotFound
+	}
+	ses, err := s.NegotiateSessionContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer ses.Close()
+	sec, err := i.GetSecretContext(ctx, ses)
+	if err != nil {
+		return "", err
+	}
+	v, err := sec.GetValue(ses)
+	if err != nil {
+		return "", err
+	}
+	return string(v), nil
+}
+
+// PasswordClear deletes every item matching attrs, unlocking them first if
+// needed. It reports whether anything was deleted.
+func (s Service) PasswordClear(sc Schema, attrs map[string]interface{}) (bool, error) {
+	return s.PasswordClearContext(context.Background(), sc, attrs)
+}
+
+func (s Service) PasswordClearContext(ctx context.Context, sc Schema, attrs map[string]interface{}) (bool, error) {
+	a, err := sc.SearchAttributes(attrs)
+	if err != nil {
+		return false, err
+	}
+	unlocked, locked, err := s.SearchItemsContext(ctx, a)
+	if err != nil {
+		return false, err
+	}
+	if len(locked) != 0 {
+		done, err := s.UnlockContext(ctx, itemObjects(locked))
+		if err != nil {
+			return false, err
+		}
+		for _, o := range done {
+			if i, ok := o.(Item); ok {
+				unlocked = append(unlocked, i)
+			}
+		}
+	}
+	for n, i := range unlocked {
+		if err := i.DeleteContext(ctx); err != nil {
+			return n != 0, err
+		}
+	}
+	return len(unlocked) != 0, nil
+}
+
+// PasswordSearch returns every item matching attrs, unlocked items first.
+// Nothing is unlocked; use Service.Unlock and Service.GetSecretValues to
+// read them.
+func (s Service) PasswordSearch(sc Schema, attrs map[string]interface{}) ([]Item, error) {
+	return s.PasswordSearchContext(context.Background(), sc, attrs)
+}
+
+func (s Service) PasswordSearchContext(ctx context.Context, sc Schema, attrs map[string]interface{}) ([]Item, error) {
+	a, err := sc.SearchAttributes(attrs)
+	if err != nil {
+		return []Item{}, err
+	}
+	unlocked, locked, err := s.SearchItemsContext(ctx, a)
+	if err != nil {
+		return []Item{}, err
+	}
+	return append(unlocked, locked...), nil
+}
+
+func (s Service) passwordCollection(ctx context.Context, name string) (Collection, error) {
+	if name == "" {
+		name = "default"
+	}
+	if name[0] == '/' {
+		return s.client.Collection(dbus.ObjectPath(name)), nil
+	}
+	c, err := s.ReadAliasContext(ctx, name)
+	if err != nil {
+		return Collection{}, err
+	}
+	switch {
+	case c.Path() != "/":
+		return c, nil
+	case name != "default":
+		return Collection{}, &Error{Path: c.Path(), Err: NoSuchObject}
+	}
+	// Like libsecret, make a default collection if there isn't one.
+	return s.CreateCollectionContext(ctx, "Default keyring", name)
+}
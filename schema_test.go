@@ -0,0 +1,101 @@
+package ss
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testSchema = Schema{
+	Name: "org.example.Test",
+	Attributes: map[string]AttributeType{
+		"name":    AttributeString,
+		"port":    AttributeInteger,
+		"enabled": AttributeBoolean,
+	},
+}
+
+func TestSchemaEncode(t *testing.T) {
+	for _, c := range []struct {
+		in   map[string]interface{}
+		want map[string]string
+	}{
+		{
+			map[string]interface{}{"name": "x", "port": 8080, "enabled": true},
+			map[string]string{"name": "x", "port": "8080", "enabled": "true"},
+		},
+		{
+			map[string]interface{}{"port": uint16(22), "enabled": false},
+			map[string]string{"port": "22", "enabled": "false"},
+		},
+		{
+			map[string]interface{}{"port": "-1", "enabled": "true"},
+			map[string]string{"port": "-1", "enabled": "true"},
+		},
+		{
+			map[string]interface{}{"name": "x", SchemaAttribute: "org.example.Test"},
+			map[string]string{"name": "x"},
+		},
+	} {
+		got, err := testSchema.Encode(c.in)
+		if err != nil {
+			t.Errorf("%v: %v", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v: got %v, want %v", c.in, got, c.want)
+		}
+	}
+
+	for _, in := range []map[string]interface{}{
+		{"unknown": "x"},
+		{"name": 1},
+		{"port": "eighty"},
+		{"port": 1.5},
+		{"enabled": "yes"},
+		{SchemaAttribute: "org.example.Other"},
+	} {
+		if _, err := testSchema.Encode(in); err == nil {
+			t.Errorf("%v: expected an error", in)
+		}
+	}
+}
+
+func TestSchemaAttributes(t *testing.T) {
+	in := map[string]interface{}{"name": "x"}
+
+	got, err := testSchema.StoreAttributes(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[SchemaAttribute] != testSchema.Name {
+		t.Errorf("store: missing %s: %v", SchemaAttribute, got)
+	}
+
+	got, err = testSchema.SearchAttributes(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[SchemaAttribute] != testSchema.Name {
+		t.Errorf("search: missing %s: %v", SchemaAttribute, got)
+	}
+
+	sc := testSchema
+	sc.Flags = SchemaDontMatchName
+	got, err = sc.SearchAttributes(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got[SchemaAttribute]; ok {
+		t.Errorf("search: unexpected %s with SchemaDontMatchName: %v", SchemaAttribute, got)
+	}
+	if got, _ = sc.StoreAttributes(in); got[SchemaAttribute] != sc.Name {
+		t.Errorf("store: missing %s with SchemaDontMatchName: %v", SchemaAttribute, got)
+	}
+
+	if got, err = testSchema.SearchAttributes(nil); err != nil || len(got) != 1 || got[SchemaAttribute] != testSchema.Name {
+		t.Errorf("search without attributes: got %v, %v", got, err)
+	}
+	if _, err := sc.SearchAttributes(nil); err == nil {
+		t.Error("search: expected an error without attributes with SchemaDontMatchName")
+	}
+}
@@ -0,0 +1,63 @@
+// +build linux
+
+package server
+
+import (
+	"time"
+)
+
+// Collection is what a Backend knows about a collection.
+type Collection struct {
+	Label    string
+	Locked   bool
+	Created  time.Time
+	Modified time.Time
+}
+
+// Item is what a Backend knows about an item. An item is locked when its
+// collection is.
+type Item struct {
+	Label      string
+	Type       string
+	Attributes map[string]string
+	Created    time.Time
+	Modified   time.Time
+}
+
+// Secret is an item's secret, in the clear.
+type Secret struct {
+	Value       []byte
+	ContentType string
+}
+
+// Backend stores collections and items for a Server.
+//
+// Collections and items are named by IDs the Backend picks. The Server
+// makes object paths out of them, so an ID must be a valid path element:
+// ASCII letters, digits and underscores.
+//
+// The Server calls Backend methods one at a time. Errors wrapping
+// ss.NoSuchObject and ss.IsLocked are sent to clients as the matching
+// Secret Service errors; anything else is a generic failure.
+type Backend interface {
+	Collections() ([]string, error)
+	Collection(id string) (Collection, error)
+	CreateCollection(label string) (string, error)
+	SetCollectionLabel(id, label string) error
+	DeleteCollection(id string) error
+	Lock(id string) error
+	Unlock(id string) error
+
+	// Aliases maps alias names to collection IDs.
+	Aliases() (map[string]string, error)
+	// SetAlias points name at a collection, or removes it if id is empty.
+	SetAlias(name, id string) error
+
+	Items(collection string) ([]string, error)
+	Item(collection, id string) (Item, error)
+	CreateItem(collection string, i Item, s Secret) (string, error)
+	SetItem(collection, id string, i Item) error
+	DeleteItem(collection, id string) error
+	GetSecret(collection, id string) (Secret, error)
+	SetSecret(collection, id string, s Secret) error
+}
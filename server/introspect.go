@@ -0,0 +1,197 @@
+// +build linux
+
+package server
+
+import (
+	"sort"
+	"strings"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+// Introspection data for each interface, from the spec.
+var interfaceXML = map[string]string{
+	_Introspectable: `
+  <interface name="org.freedesktop.DBus.Introspectable">
+    <method name="Introspect">
+      <arg name="data" direction="out" type="s"/>
+    </method>
+  </interface>`,
+	_Properties: `
+  <interface name="org.freedesktop.DBus.Properties">
+    <method name="Get">
+      <arg name="interface" direction="in" type="s"/>
+      <arg name="property" direction="in" type="s"/>
+      <arg name="value" direction="out" type="v"/>
+    </method>
+    <method name="GetAll">
+      <arg name="interface" direction="in" type="s"/>
+      <arg name="properties" direction="out" type="a{sv}"/>
+    </method>
+    <method name="Set">
+      <arg name="interface" direction="in" type="s"/>
+      <arg name="property" direction="in" type="s"/>
+      <arg name="value" direction="in" type="v"/>
+    </method>
+  </interface>`,
+	_Service: `
+  <interface name="org.freedesktop.Secret.Service">
+    <property name="Collections" type="ao" access="read"/>
+    <method name="OpenSession">
+      <arg name="algorithm" direction="in" type="s"/>
+      <arg name="input" direction="in" type="v"/>
+      <arg name="output" direction="out" type="v"/>
+      <arg name="result" direction="out" type="o"/>
+    </method>
+    <method name="CreateCollection">
+      <arg name="properties" direction="in" type="a{sv}"/>
+      <arg name="alias" direction="in" type="s"/>
+      <arg name="collection" direction="out" type="o"/>
+      <arg name="prompt" direction="out" type="o"/>
+    </method>
+    <method name="SearchItems">
+      <arg name="attributes" direction="in" type="a{ss}"/>
+      <arg name="unlocked" direction="out" type="ao"/>
+      <arg name="locked" direction="out" type="ao"/>
+    </method>
+    <method name="Unlock">
+      <arg name="objects" direction="in" type="ao"/>
+      <arg name="unlocked" direction="out" type="ao"/>
+      <arg name="prompt" direction="out" type="o"/>
+    </method>
+    <method name="Lock">
+      <arg name="objects" direction="in" type="ao"/>
+      <arg name="locked" direction="out" type="ao"/>
+      <arg name="Prompt" direction="out" type="o"/>
+    </method>
+    <method name="GetSecrets">
+      <arg name="items" direction="in" type="ao"/>
+      <arg name="session" direction="in" type="o"/>
+      <arg name="secrets" direction="out" type="a{o(oayays)}"/>
+    </method>
+    <method name="ReadAlias">
+      <arg name="name" direction="in" type="s"/>
+      <arg name="collection" direction="out" type="o"/>
+    </method>
+    <method name="SetAlias">
+      <arg name="name" direction="in" type="s"/>
+      <arg name="collection" direction="in" type="o"/>
+    </method>
+    <signal name="CollectionCreated">
+      <arg name="collection" type="o"/>
+    </signal>
+    <signal name="CollectionDeleted">
+      <arg name="collection" type="o"/>
+    </signal>
+    <signal name="CollectionChanged">
+      <arg name="collection" type="o"/>
+    </signal>
+  </interface>`,
+	_Collection: `
+  <interface name="org.freedesktop.Secret.Collection">
+    <property name="Items" type="ao" access="read"/>
+    <property name="Label" type="s" access="readwrite"/>
+    <property name="Locked" type="b" access="read"/>
+    <property name="Created" type="t" access="read"/>
+    <property name="Modified" type="t" access="read"/>
+    <method name="Delete">
+      <arg name="prompt" direction="out" type="o"/>
+    </method>
+    <method name="SearchItems">
+      <arg name="attributes" direction="in" type="a{ss}"/>
+      <arg name="results" direction="out" type="ao"/>
+    </method>
+    <method name="CreateItem">
+      <arg name="properties" direction="in" type="a{sv}"/>
+      <arg name="secret" direction="in" type="(oayays)"/>
+      <arg name="replace" direction="in" type="b"/>
+      <arg name="item" direction="out" type="o"/>
+      <arg name="prompt" direction="out" type="o"/>
+    </method>
+    <signal name="ItemCreated">
+      <arg name="item" type="o"/>
+    </signal>
+    <signal name="ItemDeleted">
+      <arg name="item" type="o"/>
+    </signal>
+    <signal name="ItemChanged">
+      <arg name="item" type="o"/>
+    </signal>
+  </interface>`,
+	_Item: `
+  <interface name="org.freedesktop.Secret.Item">
+    <property name="Locked" type="b" access="read"/>
+    <property name="Attributes" type="a{ss}" access="readwrite"/>
+    <property name="Label" type="s" access="readwrite"/>
+    <property name="Type" type="s" access="readwrite"/>
+    <property name="Created" type="t" access="read"/>
+    <property name="Modified" type="t" access="read"/>
+    <method name="Delete">
+      <arg name="Prompt" direction="out" type="o"/>
+    </method>
+    <method name="GetSecret">
+      <arg name="session" direction="in" type="o"/>
+      <arg name="secret" direction="out" type="(oayays)"/>
+    </method>
+    <method name="SetSecret">
+      <arg name="secret" direction="in" type="(oayays)"/>
+    </method>
+  </interface>`,
+	_Session: `
+  <interface name="org.freedesktop.Secret.Session">
+    <method name="Close"/>
+  </interface>`,
+	_Prompt: `
+  <interface name="org.freedesktop.Secret.Prompt">
+    <method name="Prompt">
+      <arg name="window-id" direction="in" type="s"/>
+    </method>
+    <method name="Dismiss"/>
+    <signal name="Completed">
+      <arg name="dismissed" type="b"/>
+      <arg name="result" type="v"/>
+    </signal>
+  </interface>`,
+}
+
+const introspectHeader = `<!DOCTYPE node PUBLIC "-//freedesktop//DTD D-BUS Object Introspection 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/introspect.dtd">
+<node>`
+
+// introspectable implements org.freedesktop.DBus.Introspectable, for the
+// Server's objects and the nodes above them.
+type introspectable struct {
+	s    *Server
+	path dbus.ObjectPath
+}
+
+func (o *introspectable) Introspect() (string, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := &strings.Builder{}
+	b.WriteString(introspectHeader)
+	for _, iface := range s.exported[o.path] {
+		b.WriteString(interfaceXML[iface])
+	}
+	prefix := string(o.path) + "/"
+	if o.path == "/" {
+		prefix = "/"
+	}
+	children := map[string]bool{}
+	for p := range s.exported {
+		if p != o.path && strings.HasPrefix(string(p), prefix) {
+			children[strings.SplitN(string(p)[len(prefix):], "/", 2)[0]] = true
+		}
+	}
+	names := make([]string, 0, len(children))
+	for c := range children {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+	for _, c := range names {
+		b.WriteString("\n  <node name=\"" + c + "\"/>")
+	}
+	b.WriteString("\n</node>\n")
+	return b.String(), nil
+}
@@ -0,0 +1,501 @@
+// +build linux
+
+package server
+
+import (
+	"sort"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+)
+
+func matches(attrs, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := attrs[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+func sortPaths(p []dbus.ObjectPath) {
+	sort.Slice(p, func(i, j int) bool { return p[i] < p[j] })
+}
+
+// unlocked returns an IsLocked error if the collection is locked.
+func (s *Server) unlocked(collection string) *dbus.Error {
+	info, err := s.backend.Collection(collection)
+	if err != nil {
+		return dbusError(err)
+	}
+	if info.Locked {
+		return errorf("org.freedesktop.Secret.Error.IsLocked", "%s is locked", collectionPath(collection))
+	}
+	return nil
+}
+
+// service implements org.freedesktop.Secret.Service.
+type service struct {
+	s *Server
+}
+
+func (o *service) CreateCollection(props map[string]dbus.Variant, alias string) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.aliases[alias]; ok && alias != "" {
+		return collectionPath(id), noPrompt, nil
+	}
+	label, _ := props[ss.CollectionLabelProperty].Value().(string)
+	create := func() (dbus.Variant, *dbus.Error) {
+		id, err := s.backend.CreateCollection(label)
+		if err != nil {
+			return dbus.Variant{}, dbusError(err)
+		}
+		if err := s.exportCollection(id); err != nil {
+			return dbus.Variant{}, dbusError(err)
+		}
+		s.collectionEvent(ss.EventCreated, id)
+		if alias != "" {
+			if err := s.backend.SetAlias(alias, id); err != nil {
+				return dbus.Variant{}, dbusError(err)
+			}
+			if err := s.syncAliases(); err != nil {
+				return dbus.Variant{}, dbusError(err)
+			}
+		}
+		return dbus.MakeVariant(collectionPath(id)), nil
+	}
+	if s.Prompter == nil {
+		v, err := create()
+		if err != nil {
+			return noPrompt, noPrompt, err
+		}
+		return v.Value().(dbus.ObjectPath), noPrompt, nil
+	}
+	p, err := s.newPrompt(PromptRequest{Kind: PromptCreateCollection, Label: label}, create)
+	return noPrompt, p, err
+}
+
+func (o *service) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlocked, locked := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+	ids, err := s.backend.Collections()
+	if err != nil {
+		return nil, nil, dbusError(err)
+	}
+	for _, c := range ids {
+		info, err := s.backend.Collection(c)
+		if err != nil {
+			return nil, nil, dbusError(err)
+		}
+		found, derr := s.search(c, attrs)
+		if derr != nil {
+			return nil, nil, derr
+		}
+		if info.Locked {
+			locked = append(locked, found...)
+		} else {
+			unlocked = append(unlocked, found...)
+		}
+	}
+	sortPaths(unlocked)
+	sortPaths(locked)
+	return unlocked, locked, nil
+}
+
+func (s *Server) search(collection string, attrs map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	ids, err := s.backend.Items(collection)
+	if err != nil {
+		return nil, dbusError(err)
+	}
+	ret := []dbus.ObjectPath{}
+	for _, id := range ids {
+		i, err := s.backend.Item(collection, id)
+		if err != nil {
+			return nil, dbusError(err)
+		}
+		if matches(i.Attributes, attrs) {
+			ret = append(ret, itemPath(collection, id))
+		}
+	}
+	return ret, nil
+}
+
+func (o *service) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done, pending := []dbus.ObjectPath{}, []dbus.ObjectPath{}
+	for _, p := range objects {
+		c, _, ok := s.resolve(p)
+		if !ok {
+			continue
+		}
+		info, err := s.backend.Collection(c)
+		switch {
+		case err != nil:
+		case info.Locked:
+			pending = append(pending, p)
+		default:
+			done = append(done, p)
+		}
+	}
+	if len(pending) == 0 {
+		return done, noPrompt, nil
+	}
+	unlock := func() (dbus.Variant, *dbus.Error) {
+		unlocked := []dbus.ObjectPath{}
+		for _, p := range pending {
+			c, _, ok := s.resolve(p)
+			if !ok {
+				continue
+			}
+			info, err := s.backend.Collection(c)
+			if err != nil {
+				continue
+			}
+			if info.Locked {
+				if err := s.backend.Unlock(c); err != nil {
+					return dbus.Variant{}, dbusError(err)
+				}
+				s.collectionEvent(ss.EventChanged, c)
+			}
+			unlocked = append(unlocked, p)
+		}
+		return dbus.MakeVariant(unlocked), nil
+	}
+	if s.Prompter == nil {
+		v, err := unlock()
+		if err != nil {
+			return nil, noPrompt, err
+		}
+		return append(done, v.Value().([]dbus.ObjectPath)...), noPrompt, nil
+	}
+	p, err := s.newPrompt(PromptRequest{Kind: PromptUnlock, Objects: pending}, unlock)
+	return done, p, err
+}
+
+func (o *service) Lock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	done := []dbus.ObjectPath{}
+	for _, p := range objects {
+		c, _, ok := s.resolve(p)
+		if !ok {
+			continue
+		}
+		info, err := s.backend.Collection(c)
+		if err != nil {
+			continue
+		}
+		if !info.Locked {
+			if err := s.backend.Lock(c); err != nil {
+				return nil, noPrompt, dbusError(err)
+			}
+			s.collectionEvent(ss.EventChanged, c)
+		}
+		done = append(done, p)
+	}
+	return done, noPrompt, nil
+}
+
+func (o *service) GetSecrets(sender dbus.Sender, items []dbus.ObjectPath, session dbus.ObjectPath) (map[dbus.ObjectPath]ss.Secret, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ses, derr := s.session(session, sender)
+	if derr != nil {
+		return nil, derr
+	}
+	ret := make(map[dbus.ObjectPath]ss.Secret)
+	for _, p := range items {
+		c, i, ok := s.resolve(p)
+		if !ok || i == "" || s.unlocked(c) != nil {
+			continue
+		}
+		sec, err := s.backend.GetSecret(c, i)
+		if err != nil {
+			// Locked and missing items are left out.
+			continue
+		}
+		v, derr := ses.encode(session, sec)
+		if derr != nil {
+			return nil, derr
+		}
+		ret[p] = v
+	}
+	return ret, nil
+}
+
+func (o *service) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.aliases[name]; ok {
+		return collectionPath(id), nil
+	}
+	return noPrompt, nil
+}
+
+func (o *service) SetAlias(name string, collection dbus.ObjectPath) *dbus.Error {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := ""
+	if collection != noPrompt {
+		c, i, ok := s.resolve(collection)
+		if !ok || i != "" {
+			return noSuchObject(collection)
+		}
+		if _, err := s.backend.Collection(c); err != nil {
+			return dbusError(err)
+		}
+		id = c
+	}
+	if err := s.backend.SetAlias(name, id); err != nil {
+		return dbusError(err)
+	}
+	return dbusError(s.syncAliases())
+}
+
+func (o *service) properties() (string, map[string]dbus.Variant, *dbus.Error) {
+	ids, err := o.s.backend.Collections()
+	if err != nil {
+		return _Service, nil, dbusError(err)
+	}
+	cs := make([]dbus.ObjectPath, len(ids))
+	for n, id := range ids {
+		cs[n] = collectionPath(id)
+	}
+	sortPaths(cs)
+	return _Service, map[string]dbus.Variant{"Collections": dbus.MakeVariant(cs)}, nil
+}
+
+func (o *service) setProperty(name string, v dbus.Variant) *dbus.Error {
+	return readOnly(_Service, name)
+}
+
+// collectionObject implements org.freedesktop.Secret.Collection.
+type collectionObject struct {
+	s  *Server
+	id string
+}
+
+func (o *collectionObject) Delete() (dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.backend.DeleteCollection(o.id); err != nil {
+		return noPrompt, dbusError(err)
+	}
+	s.unexportCollection(o.id)
+	s.collectionEvent(ss.EventDeleted, o.id)
+	return noPrompt, dbusError(s.syncAliases())
+}
+
+func (o *collectionObject) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ret, err := s.search(o.id, attrs)
+	if err != nil {
+		return nil, err
+	}
+	sortPaths(ret)
+	return ret, nil
+}
+
+func (o *collectionObject) CreateItem(sender dbus.Sender, props map[string]dbus.Variant, secret ss.Secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.unlocked(o.id); err != nil {
+		return noPrompt, noPrompt, err
+	}
+	i := Item{}
+	i.Label, _ = props[ss.ItemLabelProperty].Value().(string)
+	i.Type, _ = props[ss.ItemTypeProperty].Value().(string)
+	i.Attributes, _ = props[ss.ItemAttributesProperty].Value().(map[string]string)
+	if i.Attributes == nil {
+		i.Attributes = map[string]string{}
+	}
+	sec, derr := s.decode(secret, sender)
+	if derr != nil {
+		return noPrompt, noPrompt, derr
+	}
+	if replace {
+		ids, err := s.backend.Items(o.id)
+		if err != nil {
+			return noPrompt, noPrompt, dbusError(err)
+		}
+		for _, id := range ids {
+			old, err := s.backend.Item(o.id, id)
+			if err != nil || len(old.Attributes) != len(i.Attributes) || !matches(old.Attributes, i.Attributes) {
+				continue
+			}
+			if err := s.backend.SetItem(o.id, id, i); err != nil {
+				return noPrompt, noPrompt, dbusError(err)
+			}
+			if err := s.backend.SetSecret(o.id, id, sec); err != nil {
+				return noPrompt, noPrompt, dbusError(err)
+			}
+			s.itemEvent(ss.EventChanged, o.id, id)
+			return itemPath(o.id, id), noPrompt, nil
+		}
+	}
+	id, err := s.backend.CreateItem(o.id, i, sec)
+	if err != nil {
+		return noPrompt, noPrompt, dbusError(err)
+	}
+	if err := s.exportItem(o.id, id); err != nil {
+		return noPrompt, noPrompt, dbusError(err)
+	}
+	s.itemEvent(ss.EventCreated, o.id, id)
+	return itemPath(o.id, id), noPrompt, nil
+}
+
+func (o *collectionObject) properties() (string, map[string]dbus.Variant, *dbus.Error) {
+	s := o.s
+	info, err := s.backend.Collection(o.id)
+	if err != nil {
+		return _Collection, nil, dbusError(err)
+	}
+	ids, err := s.backend.Items(o.id)
+	if err != nil {
+		return _Collection, nil, dbusError(err)
+	}
+	items := make([]dbus.ObjectPath, len(ids))
+	for n, id := range ids {
+		items[n] = itemPath(o.id, id)
+	}
+	sortPaths(items)
+	return _Collection, map[string]dbus.Variant{
+		"Items":    dbus.MakeVariant(items),
+		"Label":    dbus.MakeVariant(info.Label),
+		"Locked":   dbus.MakeVariant(info.Locked),
+		"Created":  dbus.MakeVariant(uint64(info.Created.Unix())),
+		"Modified": dbus.MakeVariant(uint64(info.Modified.Unix())),
+	}, nil
+}
+
+func (o *collectionObject) setProperty(name string, v dbus.Variant) *dbus.Error {
+	l, ok := v.Value().(string)
+	if name != "Label" || !ok {
+		return readOnly(_Collection, name)
+	}
+	if err := o.s.backend.SetCollectionLabel(o.id, l); err != nil {
+		return dbusError(err)
+	}
+	o.s.collectionEvent(ss.EventChanged, o.id)
+	return nil
+}
+
+// itemObject implements org.freedesktop.Secret.Item.
+type itemObject struct {
+	s          *Server
+	collection string
+	id         string
+}
+
+func (o *itemObject) Delete() (dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.unlocked(o.collection); err != nil {
+		return noPrompt, err
+	}
+	if err := s.backend.DeleteItem(o.collection, o.id); err != nil {
+		return noPrompt, dbusError(err)
+	}
+	s.unexportItem(o.collection, o.id)
+	s.itemEvent(ss.EventDeleted, o.collection, o.id)
+	return noPrompt, nil
+}
+
+func (o *itemObject) GetSecret(sender dbus.Sender, session dbus.ObjectPath) (ss.Secret, *dbus.Error) {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ses, derr := s.session(session, sender)
+	if derr != nil {
+		return ss.Secret{}, derr
+	}
+	if err := s.unlocked(o.collection); err != nil {
+		return ss.Secret{}, err
+	}
+	sec, err := s.backend.GetSecret(o.collection, o.id)
+	if err != nil {
+		return ss.Secret{}, dbusError(err)
+	}
+	return ses.encode(session, sec)
+}
+
+func (o *itemObject) SetSecret(sender dbus.Sender, secret ss.Secret) *dbus.Error {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.unlocked(o.collection); err != nil {
+		return err
+	}
+	sec, derr := s.decode(secret, sender)
+	if derr != nil {
+		return derr
+	}
+	if err := s.backend.SetSecret(o.collection, o.id, sec); err != nil {
+		return dbusError(err)
+	}
+	s.itemEvent(ss.EventChanged, o.collection, o.id)
+	return nil
+}
+
+func (o *itemObject) properties() (string, map[string]dbus.Variant, *dbus.Error) {
+	s := o.s
+	c, err := s.backend.Collection(o.collection)
+	if err != nil {
+		return _Item, nil, dbusError(err)
+	}
+	i, err := s.backend.Item(o.collection, o.id)
+	if err != nil {
+		return _Item, nil, dbusError(err)
+	}
+	return _Item, map[string]dbus.Variant{
+		"Locked":     dbus.MakeVariant(c.Locked),
+		"Attributes": dbus.MakeVariant(i.Attributes),
+		"Label":      dbus.MakeVariant(i.Label),
+		"Type":       dbus.MakeVariant(i.Type),
+		"Created":    dbus.MakeVariant(uint64(i.Created.Unix())),
+		"Modified":   dbus.MakeVariant(uint64(i.Modified.Unix())),
+	}, nil
+}
+
+func (o *itemObject) setProperty(name string, v dbus.Variant) *dbus.Error {
+	s := o.s
+	if err := s.unlocked(o.collection); err != nil {
+		return err
+	}
+	i, err := s.backend.Item(o.collection, o.id)
+	if err != nil {
+		return dbusError(err)
+	}
+	str, isString := v.Value().(string)
+	attrs, isMap := v.Value().(map[string]string)
+	switch {
+	case name == "Label" && isString:
+		i.Label = str
+	case name == "Type" && isString:
+		i.Type = str
+	case name == "Attributes" && isMap:
+		i.Attributes = attrs
+	default:
+		return readOnly(_Item, name)
+	}
+	if err := s.backend.SetItem(o.collection, o.id, i); err != nil {
+		return dbusError(err)
+	}
+	s.itemEvent(ss.EventChanged, o.collection, o.id)
+	return nil
+}
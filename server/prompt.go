@@ -0,0 +1,128 @@
+// +build linux
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+// PromptKind is what a prompt is for.
+type PromptKind int
+
+const (
+	PromptUnlock PromptKind = iota
+	PromptCreateCollection
+)
+
+func (k PromptKind) String() string {
+	switch k {
+	case PromptUnlock:
+		return "unlock"
+	case PromptCreateCollection:
+		return "create collection"
+	}
+	return fmt.Sprintf("PromptKind(%d)", int(k))
+}
+
+// PromptRequest describes a prompt a client runs.
+type PromptRequest struct {
+	Kind PromptKind
+	// The objects to unlock, for PromptUnlock.
+	Objects []dbus.ObjectPath
+	// The new collection's label, for PromptCreateCollection.
+	Label string
+	// The window ID the client passed, if any.
+	WindowID string
+}
+
+// Prompter asks the user about a prompt. It's called in a goroutine of its
+// own, and returns whether the user accepted. The context is cancelled if
+// the client dismisses the prompt or the Server is closed, and the result
+// is then ignored.
+type Prompter interface {
+	Prompt(ctx context.Context, r PromptRequest) bool
+}
+
+// PromptFunc adapts a function to a Prompter.
+type PromptFunc func(ctx context.Context, r PromptRequest) bool
+
+func (f PromptFunc) Prompt(ctx context.Context, r PromptRequest) bool {
+	return f(ctx, r)
+}
+
+// prompt implements org.freedesktop.Secret.Prompt. The action runs, with
+// s.mu held, if the Prompter accepts.
+type prompt struct {
+	s       *Server
+	path    dbus.ObjectPath
+	req     PromptRequest
+	action  func() (dbus.Variant, *dbus.Error)
+	started bool
+	cancel  context.CancelFunc
+}
+
+// newPrompt expects s.mu to be held.
+func (s *Server) newPrompt(r PromptRequest, action func() (dbus.Variant, *dbus.Error)) (dbus.ObjectPath, *dbus.Error) {
+	p := &prompt{s: s, req: r, action: action, cancel: func() {}}
+	p.path = dbus.ObjectPath(fmt.Sprintf("%s/p%d", promptPath, next()))
+	if err := s.exportObject(p, p.path, _Prompt); err != nil {
+		return noPrompt, dbusError(err)
+	}
+	s.prompts[p.path] = p
+	return p.path, nil
+}
+
+func (p *prompt) Prompt(windowID string) *dbus.Error {
+	s := p.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.started || s.prompts[p.path] == nil {
+		return noSuchObject(p.path)
+	}
+	p.started = true
+	r := p.req
+	r.WindowID = windowID
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go func() {
+		ok := s.Prompter.Prompt(ctx, r)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		if !ok {
+			p.finish(true, dbus.MakeVariant(""))
+			return
+		}
+		v, err := p.action()
+		p.finish(err != nil, v)
+	}()
+	return nil
+}
+
+func (p *prompt) Dismiss() *dbus.Error {
+	s := p.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.prompts[p.path] == nil {
+		return noSuchObject(p.path)
+	}
+	p.finish(true, dbus.MakeVariant(""))
+	return nil
+}
+
+// finish emits Completed and unexports the prompt. It expects s.mu to be
+// held.
+func (p *prompt) finish(dismissed bool, result dbus.Variant) {
+	p.cancel()
+	if result.Signature().String() == "" {
+		result = dbus.MakeVariant("")
+	}
+	p.s.conn.Emit(p.path, _Prompt+".Completed", dismissed, result)
+	delete(p.s.prompts, p.path)
+	p.s.unexport(p.path)
+}
@@ -0,0 +1,62 @@
+// +build linux
+
+package server
+
+import (
+	dbus "github.com/guelfey/go.dbus"
+)
+
+// propertier is implemented by the objects that have properties.
+type propertier interface {
+	properties() (string, map[string]dbus.Variant, *dbus.Error)
+	setProperty(name string, v dbus.Variant) *dbus.Error
+}
+
+func readOnly(iface, name string) *dbus.Error {
+	return errorf("org.freedesktop.DBus.Error.PropertyReadOnly", "%s.%s can't be set", iface, name)
+}
+
+// properties implements org.freedesktop.DBus.Properties for one object.
+type properties struct {
+	s    *Server
+	path dbus.ObjectPath
+	obj  propertier
+}
+
+func (o *properties) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	all, err := o.GetAll(iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	v, ok := all[name]
+	if !ok {
+		return dbus.Variant{}, errorf("org.freedesktop.DBus.Error.UnknownProperty", "no property %s.%s", iface, name)
+	}
+	return v, nil
+}
+
+func (o *properties) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	have, props, err := o.obj.properties()
+	if err != nil {
+		return nil, err
+	}
+	if iface != have {
+		return nil, errorf("org.freedesktop.DBus.Error.UnknownInterface", "%s has no interface %s", o.path, iface)
+	}
+	return props, nil
+}
+
+func (o *properties) Set(iface, name string, v dbus.Variant) *dbus.Error {
+	o.s.mu.Lock()
+	defer o.s.mu.Unlock()
+	have, _, err := o.obj.properties()
+	if err != nil {
+		return err
+	}
+	if iface != have {
+		return errorf("org.freedesktop.DBus.Error.UnknownInterface", "%s has no interface %s", o.path, iface)
+	}
+	return o.obj.setProperty(name, v)
+}
@@ -0,0 +1,394 @@
+// +build linux
+
+/*
+Package server exports a Backend on the bus as a Secret Service provider.
+
+The Server takes care of the protocol: sessions (plain and
+dh-ietf1024-sha256-aes128-cbc-pkcs7), properties, signals, prompts and
+introspection. The Backend only stores collections and items.
+
+	srv, err := server.New(conn, backend)
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+	_, err = conn.RequestName(ss.ServiceName, dbus.NameFlagDoNotQueue)
+*/
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/internal/bus"
+)
+
+const (
+	aliasPath   = ss.ServicePath + "/aliases"
+	sessionPath = ss.ServicePath + "/session"
+	promptPath  = ss.ServicePath + "/prompt"
+
+	noPrompt = dbus.ObjectPath("/")
+
+	_Properties     = "org.freedesktop.DBus.Properties"
+	_Introspectable = "org.freedesktop.DBus.Introspectable"
+	_Service        = "org.freedesktop.Secret.Service"
+	_Collection     = "org.freedesktop.Secret.Collection"
+	_Item           = "org.freedesktop.Secret.Item"
+	_Session        = "org.freedesktop.Secret.Session"
+	_Prompt         = "org.freedesktop.Secret.Prompt"
+
+	_DBus         = "org.freedesktop.DBus"
+	_DBusPath     = "/org/freedesktop/DBus"
+	_NameHasOwner = _DBus + ".NameHasOwner"
+)
+
+// Server exports a Backend on a connection. Only one Server may be exported
+// on a connection at a time.
+type Server struct {
+	// Prompter decides the prompts clients run. If nil, the Server
+	// never prompts: collections are unlocked and created right away.
+	//
+	// Set it before clients use the Server.
+	Prompter Prompter
+
+	conn    *dbus.Conn
+	backend Backend
+	// NameOwnerChanged, for peers leaving.
+	peers *bus.Subscription
+
+	mu       sync.Mutex
+	sessions map[dbus.ObjectPath]*session
+	prompts  map[dbus.ObjectPath]*prompt
+	exported map[dbus.ObjectPath][]string
+	aliases  map[string]string
+}
+
+// New exports b on conn. Taking a bus name, usually ss.ServiceName, is up
+// to the caller.
+func New(conn *dbus.Conn, b Backend) (*Server, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("server: nil connection")
+	}
+	s := &Server{
+		conn:     conn,
+		backend:  b,
+		sessions: make(map[dbus.ObjectPath]*session),
+		prompts:  make(map[dbus.ObjectPath]*prompt),
+		exported: make(map[dbus.ObjectPath][]string),
+		aliases:  make(map[string]string),
+	}
+	if err := s.watchPeers(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.exportObject(&service{s}, ss.ServicePath, _Service); err != nil {
+		s.peers.Cancel()
+		s.unexportAll()
+		return nil, err
+	}
+	ids, err := b.Collections()
+	if err != nil {
+		s.peers.Cancel()
+		s.unexportAll()
+		return nil, err
+	}
+	for _, id := range ids {
+		if err := s.exportCollection(id); err != nil {
+			s.peers.Cancel()
+			s.unexportAll()
+			return nil, err
+		}
+	}
+	if err := s.syncAliases(); err != nil {
+		s.peers.Cancel()
+		s.unexportAll()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Conn returns the connection the Server is exported on.
+func (s *Server) Conn() *dbus.Conn {
+	return s.conn
+}
+
+// Close dismisses pending prompts, and unexports every object.
+func (s *Server) Close() {
+	s.peers.Cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.prompts {
+		p.finish(true, dbus.MakeVariant(""))
+	}
+	s.unexportAll()
+}
+
+// Sessions returns the number of open sessions.
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// Notify tells the Server about a change made to the Backend other than
+// through the Server, so it can export or unexport objects and emit
+// signals. An empty item means the collection itself changed.
+func (s *Server) Notify(ev ss.EventType, collection, item string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	switch {
+	case ev == ss.EventCreated && item == "":
+		err = s.exportCollection(collection)
+	case ev == ss.EventCreated:
+		err = s.exportItem(collection, item)
+	case ev == ss.EventDeleted && item == "":
+		s.unexportCollection(collection)
+	case ev == ss.EventDeleted:
+		s.unexportItem(collection, item)
+	}
+	if err != nil {
+		return err
+	}
+	if item == "" {
+		s.collectionEvent(ev, collection)
+		return s.syncAliases()
+	}
+	s.itemEvent(ev, collection, item)
+	return nil
+}
+
+// The methods below expect s.mu to be held.
+
+func collectionPath(id string) dbus.ObjectPath {
+	return dbus.ObjectPath(ss.CollectionPath + "/" + id)
+}
+
+func itemPath(collection, id string) dbus.ObjectPath {
+	return dbus.ObjectPath(ss.CollectionPath + "/" + collection + "/" + id)
+}
+
+// resolve returns the collection and item an object path names. Aliases
+// resolve to their collection.
+func (s *Server) resolve(p dbus.ObjectPath) (collection, item string, ok bool) {
+	var rest []string
+	switch {
+	case strings.HasPrefix(string(p), ss.CollectionPath+"/"):
+		rest = strings.Split(string(p)[len(ss.CollectionPath)+1:], "/")
+	case strings.HasPrefix(string(p), aliasPath+"/"):
+		rest = strings.Split(string(p)[len(aliasPath)+1:], "/")
+		id, ok := s.aliases[rest[0]]
+		if !ok || len(rest) != 1 {
+			return "", "", false
+		}
+		rest[0] = id
+	default:
+		return "", "", false
+	}
+	switch len(rest) {
+	case 1:
+		return rest[0], "", true
+	case 2:
+		return rest[0], rest[1], true
+	}
+	return "", "", false
+}
+
+func validID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) export(v interface{}, path dbus.ObjectPath, iface string) error {
+	if err := s.conn.Export(v, path, iface); err != nil {
+		return err
+	}
+	s.exported[path] = append(s.exported[path], iface)
+	return nil
+}
+
+// exportObject exports v at path, along with Properties and Introspectable,
+// and makes every parent of path introspectable.
+func (s *Server) exportObject(v interface{}, path dbus.ObjectPath, iface string) error {
+	for p := parent(path); p != ""; p = parent(p) {
+		if _, ok := s.exported[p]; ok {
+			continue
+		}
+		if err := s.export(&introspectable{s, p}, p, _Introspectable); err != nil {
+			return err
+		}
+	}
+	if err := s.export(v, path, iface); err != nil {
+		return err
+	}
+	if iface != _Session && iface != _Prompt {
+		if err := s.export(&properties{s, path, v.(propertier)}, path, _Properties); err != nil {
+			return err
+		}
+	}
+	return s.export(&introspectable{s, path}, path, _Introspectable)
+}
+
+func parent(p dbus.ObjectPath) dbus.ObjectPath {
+	i := strings.LastIndex(string(p), "/")
+	switch {
+	case p == "/" || i < 0:
+		return ""
+	case i == 0:
+		return "/"
+	}
+	return p[:i]
+}
+
+func (s *Server) unexport(path dbus.ObjectPath) {
+	for _, iface := range s.exported[path] {
+		s.conn.Export(nil, path, iface)
+	}
+	delete(s.exported, path)
+}
+
+func (s *Server) unexportAll() {
+	for p := range s.exported {
+		s.unexport(p)
+	}
+}
+
+func (s *Server) exportCollection(id string) error {
+	if !validID(id) {
+		return fmt.Errorf("server: invalid collection id %q", id)
+	}
+	if err := s.exportObject(&collectionObject{s, id}, collectionPath(id), _Collection); err != nil {
+		return err
+	}
+	items, err := s.backend.Items(id)
+	if err != nil {
+		return err
+	}
+	for _, i := range items {
+		if err := s.exportItem(id, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) unexportCollection(id string) {
+	prefix := string(collectionPath(id)) + "/"
+	for p := range s.exported {
+		if strings.HasPrefix(string(p), prefix) {
+			s.unexport(p)
+		}
+	}
+	s.unexport(collectionPath(id))
+}
+
+func (s *Server) exportItem(collection, id string) error {
+	if !validID(id) {
+		return fmt.Errorf("server: invalid item id %q", id)
+	}
+	return s.exportObject(&itemObject{s, collection, id}, itemPath(collection, id), _Item)
+}
+
+func (s *Server) unexportItem(collection, id string) {
+	s.unexport(itemPath(collection, id))
+}
+
+// syncAliases exports every alias as a path of its own, for clients that
+// use /org/freedesktop/secrets/aliases/default instead of ReadAlias.
+func (s *Server) syncAliases() error {
+	aliases, err := s.backend.Aliases()
+	if err != nil {
+		return err
+	}
+	for name, id := range s.aliases {
+		if aliases[name] != id {
+			s.unexport(dbus.ObjectPath(aliasPath + "/" + name))
+			delete(s.aliases, name)
+		}
+	}
+	for name, id := range aliases {
+		if _, ok := s.aliases[name]; ok || !validID(name) {
+			continue
+		}
+		if err := s.exportObject(&collectionObject{s, id}, dbus.ObjectPath(aliasPath+"/"+name), _Collection); err != nil {
+			return err
+		}
+		s.aliases[name] = id
+	}
+	return nil
+}
+
+func (s *Server) collectionEvent(ev ss.EventType, id string) {
+	var name string
+	switch ev {
+	case ss.EventCreated:
+		name = "CollectionCreated"
+	case ss.EventDeleted:
+		name = "CollectionDeleted"
+	default:
+		name = "CollectionChanged"
+	}
+	s.conn.Emit(ss.ServicePath, _Service+"."+name, collectionPath(id))
+}
+
+func (s *Server) itemEvent(ev ss.EventType, collection, id string) {
+	var name string
+	switch ev {
+	case ss.EventCreated:
+		name = "ItemCreated"
+	case ss.EventDeleted:
+		name = "ItemDeleted"
+	default:
+		name = "ItemChanged"
+	}
+	s.conn.Emit(collectionPath(collection), _Collection+"."+name, itemPath(collection, id))
+}
+
+// Paths are never reused, not even by another Server on the connection,
+// so a late call from an earlier client can't hit a new object.
+var serial uint64
+
+func next() uint64 {
+	return atomic.AddUint64(&serial, 1)
+}
+
+func errorf(name, format string, v ...interface{}) *dbus.Error {
+	return dbus.NewError(name, []interface{}{fmt.Sprintf(format, v...)})
+}
+
+func noSuchObject(p dbus.ObjectPath) *dbus.Error {
+	return errorf("org.freedesktop.Secret.Error.NoSuchObject", "no such object %s", p)
+}
+
+func noSession(p dbus.ObjectPath) *dbus.Error {
+	return errorf("org.freedesktop.Secret.Error.NoSession", "no session %s", p)
+}
+
+// dbusError turns a Backend error into one for the client.
+func dbusError(err error) *dbus.Error {
+	if err == nil {
+		return nil
+	}
+	name := "org.freedesktop.DBus.Error.Failed"
+	switch {
+	case errors.Is(err, ss.NoSuchObject):
+		name = "org.freedesktop.Secret.Error.NoSuchObject"
+	case errors.Is(err, ss.IsLocked):
+		name = "org.freedesktop.Secret.Error.IsLocked"
+	}
+	return dbus.NewError(name, []interface{}{err.Error()})
+}
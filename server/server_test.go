@@ -0,0 +1,201 @@
+package server_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/server"
+	"github.com/hdonnay/secretservice/sstest"
+)
+
+func newServer(t *testing.T) (*server.Server, *ss.Client) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		t.Skip("no session bus")
+	}
+	srv, err := server.New(conn, sstest.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ss.NewClient(conn, conn.Names()[0])
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return srv, c
+}
+
+func TestIntrospect(t *testing.T) {
+	srv, c := newServer(t)
+	defer srv.Close()
+	for _, tc := range []struct {
+		path dbus.ObjectPath
+		want []string
+	}{
+		{"/", []string{`<node name="org"/>`}},
+		{ss.ServicePath, []string{`<interface name="org.freedesktop.Secret.Service">`, `<node name="collection"/>`, `<node name="aliases"/>`}},
+		{ss.CollectionPath, []string{`<node name="login"/>`}},
+		{sstest.LoginCollection, []string{`<interface name="org.freedesktop.Secret.Collection">`, `<interface name="org.freedesktop.DBus.Properties">`}},
+	} {
+		var xml string
+		err := c.Conn().Object(srv.Conn().Names()[0], tc.path).Call("org.freedesktop.DBus.Introspectable.Introspect", 0).Store(&xml)
+		if err != nil {
+			t.Errorf("%s: %v", tc.path, err)
+			continue
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(xml, w) {
+				t.Errorf("%s: missing %s in:\n%s", tc.path, w, xml)
+			}
+		}
+	}
+}
+
+func TestNoPrompter(t *testing.T) {
+	srv, c := newServer(t)
+	defer srv.Close()
+	s := c.Service()
+
+	login := c.Collection(sstest.LoginCollection)
+	if _, err := s.Lock([]ss.Object{login}); err != nil {
+		t.Fatal(err)
+	}
+	c.Prompter = ss.NeverPrompt{}
+	done, err := s.Unlock([]ss.Object{login})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 {
+		t.Errorf("Unlock: got %v", done)
+	}
+	coll, err := s.CreateCollection("Work", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coll.Path() != ss.CollectionPath+"/Work" {
+		t.Errorf("CreateCollection: got %s", coll.Path())
+	}
+
+	// Aliases have paths of their own.
+	l, err := c.Collection(ss.ServicePath + "/aliases/work").GetLabel()
+	if err != nil || l != "Work" {
+		t.Errorf("alias label: got %q, %v", l, err)
+	}
+	if err := coll.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := s.ReadAlias("work"); err != nil || a.Path() != "/" {
+		t.Errorf("ReadAlias after Delete: got %v, %v", a.Path(), err)
+	}
+}
+
+func TestLockedItem(t *testing.T) {
+	srv, c := newServer(t)
+	defer srv.Close()
+	s := c.Service()
+	ses, err := s.OpenSession(ss.AlgoPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ses.Close()
+	login := c.Collection(sstest.LoginCollection)
+	sec, err := ses.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := login.CreateItem("x", map[string]string{"a": "b"}, sec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Lock([]ss.Object{i}); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.SetLabel("y"); err == nil {
+		t.Error("SetLabel: expected an error on a locked item")
+	}
+	if locked, err := i.Locked(); err != nil || !locked {
+		t.Errorf("Locked: got %v, %v", locked, err)
+	}
+}
+
+// peer returns a Client for srv on a connection of its own, which the
+// caller has to close.
+func peer(t *testing.T, srv *server.Server) *ss.Client {
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		t.Skip("no session bus")
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	c, err := ss.NewClient(conn, srv.Conn().Names()[0])
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestPeerGone(t *testing.T) {
+	srv, _ := newServer(t)
+	defer srv.Close()
+	c := peer(t, srv)
+	if _, err := c.Service().OpenSession(ss.AlgoDH); err != nil {
+		c.Conn().Close()
+		t.Fatal(err)
+	}
+	if n := srv.Sessions(); n != 1 {
+		t.Errorf("got %d sessions, want 1", n)
+	}
+	// Gone without closing its session.
+	c.Conn().Close()
+	for i := 0; srv.Sessions() != 0; i++ {
+		if i == 50 {
+			t.Fatalf("%d sessions left after the peer went away", srv.Sessions())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestForeignSession(t *testing.T) {
+	srv, c := newServer(t)
+	defer srv.Close()
+	ses, err := c.Service().OpenSession(ss.AlgoPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ses.Close()
+	sec, err := ses.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := c.Collection(sstest.LoginCollection).CreateItem("x", map[string]string{"a": "b"}, sec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := peer(t, srv)
+	defer other.Conn().Close()
+	stolen := other.Item(i.Path())
+	if _, err := stolen.GetSecret(ses); !errors.Is(err, ss.NoSession) {
+		t.Errorf("GetSecret: got %v, want NoSession", err)
+	}
+	if _, err := other.Service().GetSecrets([]ss.Item{stolen}, ses); !errors.Is(err, ss.NoSession) {
+		t.Errorf("GetSecrets: got %v, want NoSession", err)
+	}
+	if err := stolen.SetSecret(sec); !errors.Is(err, ss.NoSession) {
+		t.Errorf("SetSecret: got %v, want NoSession", err)
+	}
+	if _, err := i.GetSecret(ses); err != nil {
+		t.Errorf("GetSecret by the owner: %v", err)
+	}
+}
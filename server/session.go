@@ -0,0 +1,190 @@
+// +build linux
+
+package server
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/internal/bus"
+	"github.com/hdonnay/secretservice/internal/dh"
+)
+
+type session struct {
+	algo string
+	key  []byte
+	// The unique name of the peer that opened the session.
+	peer string
+}
+
+// OpenSession is part of the Service interface; it lives here with the rest
+// of the session handling.
+func (o *service) OpenSession(sender dbus.Sender, algo string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	s := o.s
+	ses := &session{algo: algo, peer: string(sender)}
+	var out dbus.Variant
+	switch algo {
+	case ss.AlgoPlain:
+		out = dbus.MakeVariant("")
+	case ss.AlgoDH:
+		pub, ok := input.Value().([]byte)
+		if !ok {
+			return out, noPrompt, errorf("org.freedesktop.DBus.Error.InvalidArgs", "input must be a byte array")
+		}
+		var err error
+		if out, ses.key, err = exchange(pub); err != nil {
+			return out, noPrompt, errorf("org.freedesktop.DBus.Error.InvalidArgs", "%v", err)
+		}
+	default:
+		return out, noPrompt, errorf("org.freedesktop.DBus.Error.NotSupported", "algorithm %q is not supported", algo)
+	}
+	s.mu.Lock()
+	p := dbus.ObjectPath(fmt.Sprintf("%s/s%d", sessionPath, next()))
+	if err := s.exportObject(&sessionObject{s, p}, p, _Session); err != nil {
+		s.mu.Unlock()
+		return out, noPrompt, dbusError(err)
+	}
+	s.sessions[p] = ses
+	s.mu.Unlock()
+	// The peer may have left before the session was recorded, in which
+	// case its NameOwnerChanged went by unnoticed.
+	if ses.peer != "" {
+		var ok bool
+		if err := s.conn.BusObject().Call(_NameHasOwner, 0, ses.peer).Store(&ok); err == nil && !ok {
+			s.dropPeer(ses.peer)
+		}
+	}
+	return out, p, nil
+}
+
+// watchPeers drops the sessions of peers that leave the bus without
+// closing them, so they don't pile up in a long-running Server.
+func (s *Server) watchPeers() error {
+	var err error
+	s.peers, err = bus.For(s.conn).Subscribe(bus.Match{
+		Sender: _DBus,
+		Path:   _DBusPath,
+		Iface:  _DBus,
+		Member: "NameOwnerChanged",
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		for sig := range s.peers.C {
+			var name, old, owner string
+			if err := dbus.Store(sig.Body, &name, &old, &owner); err != nil {
+				continue
+			}
+			if strings.HasPrefix(name, ":") && owner == "" {
+				s.dropPeer(name)
+			}
+		}
+	}()
+	return nil
+}
+
+// dropPeer closes every session peer opened.
+func (s *Server) dropPeer(peer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p, ses := range s.sessions {
+		if ses.peer == peer {
+			s.closeSession(p)
+		}
+	}
+}
+
+// closeSession forgets the session at p, and wipes its key. It expects s.mu
+// to be held.
+func (s *Server) closeSession(p dbus.ObjectPath) {
+	if ses, ok := s.sessions[p]; ok {
+		ss.Wipe(ses.key)
+		delete(s.sessions, p)
+	}
+	s.unexport(p)
+}
+
+// exchange does the server's half of the DH exchange, returning its public
+// key and the derived AES key.
+func exchange(pub []byte) (dbus.Variant, []byte, error) {
+	grp, err := dh.Group()
+	if err != nil {
+		return dbus.Variant{}, nil, err
+	}
+	// Checked first, so a bad key costs no private key.
+	if err := dh.CheckPublicKey(grp, pub); err != nil {
+		return dbus.Variant{}, nil, err
+	}
+	priv, err := grp.GeneratePrivateKey(rand.Reader)
+	if err != nil {
+		return dbus.Variant{}, nil, err
+	}
+	key, err := dh.SessionKey(grp, priv, pub)
+	if err != nil {
+		return dbus.Variant{}, nil, err
+	}
+	return dbus.MakeVariant(priv.Bytes()), key, nil
+}
+
+// sessionObject implements org.freedesktop.Secret.Session.
+type sessionObject struct {
+	s    *Server
+	path dbus.ObjectPath
+}
+
+func (o *sessionObject) Close(sender dbus.Sender) *dbus.Error {
+	s := o.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, derr := s.session(o.path, sender); derr != nil {
+		return derr
+	}
+	s.closeSession(o.path)
+	return nil
+}
+
+func (ses *session) encode(path dbus.ObjectPath, sec Secret) (ss.Secret, *dbus.Error) {
+	ret := ss.Secret{Session: path, Parameters: []byte{}, ContentType: sec.ContentType}
+	if ses.algo == ss.AlgoDH {
+		ret.Parameters = make([]byte, aes.BlockSize)
+		if _, err := io.ReadFull(rand.Reader, ret.Parameters); err != nil {
+			return ret, dbusError(err)
+		}
+	}
+	if err := ret.SetValue(ss.Session{Algorithm: ses.algo, Key: ses.key}, sec.Value); err != nil {
+		return ret, dbusError(err)
+	}
+	return ret, nil
+}
+
+// session returns the session at p, if sender opened it: like
+// gnome-keyring, the Server doesn't let peers use each other's sessions. It
+// expects s.mu to be held.
+func (s *Server) session(p dbus.ObjectPath, sender dbus.Sender) (*session, *dbus.Error) {
+	ses, ok := s.sessions[p]
+	if !ok || ses.peer != string(sender) {
+		return nil, noSession(p)
+	}
+	return ses, nil
+}
+
+func (s *Server) decode(sec ss.Secret, sender dbus.Sender) (Secret, *dbus.Error) {
+	ses, derr := s.session(sec.Session, sender)
+	if derr != nil {
+		return Secret{}, derr
+	}
+	if ses.algo == ss.AlgoDH && (len(sec.Parameters) != aes.BlockSize || len(sec.Value)%aes.BlockSize != 0) {
+		return Secret{}, errorf("org.freedesktop.DBus.Error.InvalidArgs", "bad secret: wrong length")
+	}
+	v, err := sec.GetValue(ss.Session{Algorithm: ses.algo, Key: ses.key})
+	if err != nil {
+		return Secret{}, errorf("org.freedesktop.DBus.Error.InvalidArgs", "bad secret: %v", err)
+	}
+	return Secret{Value: append([]byte{}, v...), ContentType: sec.ContentType}, nil
+}
@@ -0,0 +1,11 @@
+// +build linux
+
+package ss
+
+import "github.com/hdonnay/secretservice/internal/bus"
+
+// subscribe listens for signals from c's provider matching m.
+func (c *Client) subscribe(m bus.Match) (*bus.Subscription, error) {
+	m.Sender = c.name
+	return bus.For(c.conn).Subscribe(m)
+}
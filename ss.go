@@ -3,11 +3,13 @@
 package ss
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"fmt"
 
 	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice/internal/dh"
 	"github.com/vgorin/cryptogo/pad"
 )
 
@@ -20,7 +22,9 @@ const (
 	DefaultCollection = "/org/freedesktop/secrets/collection/default"
 	CollectionPath    = "/org/freedesktop/secrets/collection"
 
-	setProp = "org.freedesktop.DBus.Properties.Set"
+	getProp     = "org.freedesktop.DBus.Properties.Get"
+	getAllProps = "org.freedesktop.DBus.Properties.GetAll"
+	setProp     = "org.freedesktop.DBus.Properties.Set"
 
 	_Item = "org.freedesktop.Secret.Item"
 	// Methods
@@ -33,6 +37,7 @@ const (
 	_ItemModified   = "org.freedesktop.Secret.Item.Modified"
 	_ItemLabel      = "org.freedesktop.Secret.Item.Label"
 	_ItemAttributes = "org.freedesktop.Secret.Item.Attributes"
+	_ItemType       = "org.freedesktop.Secret.Item.Type"
 
 	_Prompt = "org.freedesktop.Secret.Prompt"
 	// Methods
@@ -59,6 +64,10 @@ const (
 	//Properties
 	_ServiceAlias       = "org.freedesktop.Secret.Service.Alias"
 	_ServiceCollections = "org.freedesktop.Secret.Service.Collections"
+	// Signals
+	_ServiceCollectionCreated = "org.freedesktop.Secret.Service.CollectionCreated"
+	_ServiceCollectionDeleted = "org.freedesktop.Secret.Service.CollectionDeleted"
+	_ServiceCollectionChanged = "org.freedesktop.Secret.Service.CollectionChanged"
 
 	_Collection = "org.freedesktop.Secret.Collection"
 	// Methods
@@ -71,21 +80,62 @@ const (
 	_CollectionCreated  = "org.freedesktop.Secret.Collection.Created"
 	_CollectionModified = "org.freedesktop.Secret.Collection.Modified"
 	_CollectionItems    = "org.freedesktop.Secret.Collection.Items"
+	// Signals
+	_CollectionItemCreated = "org.freedesktop.Secret.Collection.ItemCreated"
+	_CollectionItemDeleted = "org.freedesktop.Secret.Collection.ItemDeleted"
+	_CollectionItemChanged = "org.freedesktop.Secret.Collection.ItemChanged"
 
 	_Introspect = "org.freedesktop.DBus.Introspectable.Introspect"
 
+	// Property names, for CreateItemWithProperties and
+	// CreateCollectionWithProperties.
+	ItemLabelProperty       = _ItemLabel
+	ItemAttributesProperty  = _ItemAttributes
+	ItemTypeProperty        = _ItemType
+	CollectionLabelProperty = _CollectionLabel
+
 	AlgoPlain = "plain"
 	AlgoDH    = "dh-ietf1024-sha256-aes128-cbc-pkcs7"
 
 	text_plain = "text/plain; charset=utf8"
+
+	// Content types the Secret helpers use. A Secret may carry any other
+	// MIME type too.
+	ContentTypeText   = text_plain
+	ContentTypeJSON   = "application/json"
+	ContentTypePEM    = "application/x-pem-file"
+	ContentTypeBinary = "application/octet-stream"
 )
 
 var (
 	UnknownContentType = fmt.Errorf("Content-Type is unknown for this Secret")
 	InvalidAlgorithm   = fmt.Errorf("unknown algorithm")
 	InvalidSession     = fmt.Errorf("invalid session object")
-	PromptDismissed    = fmt.Errorf("prompt dismissed")
-	Timeout            = fmt.Errorf("timeout")
+	// The service's DH public key is malformed or out of range.
+	InvalidPublicKey = dh.InvalidPublicKey
+	// An encrypted Secret's IV or value has the wrong length for AES-CBC.
+	BadSecret       = fmt.Errorf("malformed encrypted secret")
+	PromptDismissed = fmt.Errorf("prompt dismissed")
+	// Also matches context.DeadlineExceeded.
+	Timeout error = &kind{"timeout", context.DeadlineExceeded}
+	// The object no longer exists, e.g. an Item deleted by another client.
+	NoSuchObject = fmt.Errorf("no such object")
+	// The object is locked, and has to be unlocked first.
+	IsLocked = fmt.Errorf("object is locked")
+	// The service can't be reached. ServiceUnknown and NoReply say why.
+	ServiceGone = fmt.Errorf("secret service gone")
+	// Nothing owns the service's bus name: the daemon isn't running.
+	ServiceUnknown error = &kind{"secret service not running", ServiceGone}
+	// The service didn't answer in time, e.g. the daemon is hung.
+	NoReply error = &kind{"secret service not answering", ServiceGone}
+	// The session a Secret names doesn't exist, e.g. it was closed.
+	NoSession = fmt.Errorf("no such session")
+	// A prompt was needed, but the Client's Prompter refused to show it.
+	PromptRequired = fmt.Errorf("prompt required")
+	// No item matched the passed attributes.
+	NotFound = fmt.Errorf("no matching item")
+	// The Client's SessionPolicy rules out a plain session.
+	PlainForbidden = fmt.Errorf("plain session forbidden by policy")
 )
 
 type Object interface {
@@ -113,9 +163,13 @@ func (s *Secret) SetValue(session Session, secret []byte) error {
 			return err
 		}
 		enc := cipher.NewCBCEncrypter(block, s.Parameters)
-		ciphertext := pad.PKCS7Pad(secret, aes.BlockSize)
-		s.Value = make([]byte, len(ciphertext))
-		enc.CryptBlocks(s.Value, ciphertext)
+		padded := pad.PKCS7Pad(secret, aes.BlockSize)
+		s.Value = make([]byte, len(padded))
+		enc.CryptBlocks(s.Value, padded)
+		// The padded copy is ours to wipe, unless it shares secret's array.
+		if cap(secret) == 0 || &padded[0] != &secret[:cap(secret)][0] {
+			Wipe(padded)
+		}
 	default:
 		return InvalidSession
 	}
@@ -133,6 +187,9 @@ func (s *Secret) GetValue(session Session) ([]byte, error) {
 		if err != nil {
 			return []byte{}, err
 		}
+		if err := s.checkCiphertext(); err != nil {
+			return []byte{}, err
+		}
 		dec := cipher.NewCBCDecrypter(block, s.Parameters)
 		dec.CryptBlocks(paddedPlaintext, s.Value)
 		return pad.PKCS7Unpad(paddedPlaintext)
@@ -141,13 +198,33 @@ func (s *Secret) GetValue(session Session) ([]byte, error) {
 	}
 }
 
+// checkCiphertext makes sure s can be handed to AES-CBC, which panics on a
+// bad IV or a partial block. PKCS#7 padding means there's at least one.
+func (s *Secret) checkCiphertext() error {
+	if len(s.Parameters) != aes.BlockSize || len(s.Value) == 0 || len(s.Value)%aes.BlockSize != 0 {
+		return BadSecret
+	}
+	return nil
+}
+
+// DialService connects to the provider owning ServiceName on the session bus.
+// A provider the bus can activate counts: it's started on the first call, as
+// D-Bus does. It returns ErrServiceUnavailable if there's no provider and
+// none can be started.
 func DialService() (Service, error) {
-	conn, err := dbus.SessionBus()
+	return DialServiceContext(context.Background(), false)
+}
+
+// DialServiceWithConn uses the provider owning busName on conn, e.g. a
+// private connection or a test service registered under another name.
+// Unlike DialService, it doesn't check anything owns busName; see
+// Client.Available and Client.Activate.
+func DialServiceWithConn(conn *dbus.Conn, busName string) (Service, error) {
+	c, err := NewClient(conn, busName)
 	if err != nil {
 		return Service{}, err
 	}
-	obj := conn.Object(ServiceName, ServicePath)
-	return Service{obj}, nil
+	return c.Service(), nil
 }
 
 func DialCollection(path string) (Collection, error) {
@@ -155,6 +232,9 @@ func DialCollection(path string) (Collection, error) {
 	if err != nil {
 		return Collection{}, err
 	}
-	obj := conn.Object(ServiceName, dbus.ObjectPath(path))
-	return Collection{obj}, nil
+	c, err := NewClient(conn, ServiceName)
+	if err != nil {
+		return Collection{}, err
+	}
+	return c.Collection(dbus.ObjectPath(path)), nil
 }
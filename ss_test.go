@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"crypto/aes"
 	"encoding/hex"
+	"errors"
 	"testing"
 )
 
 var (
 	iv = bytes.Repeat([]byte{0xFF}, aes.BlockSize)
 
-	plainSession = Session{nil, AlgoPlain, nil}
+	plainSession = Session{Algorithm: AlgoPlain}
 	plainTest    = []struct {
 		in  []byte
 		out Secret
@@ -23,7 +24,7 @@ var (
 			Secret{"/", []byte{}, []byte("another_test"), text_plain}},
 	}
 
-	cryptSession = Session{nil, AlgoDH, bytes.Repeat([]byte{44}, aes.BlockSize)}
+	cryptSession = Session{Algorithm: AlgoDH, Key: bytes.Repeat([]byte{44}, aes.BlockSize)}
 	cryptTest    = []struct {
 		in  []byte
 		out Secret
@@ -135,9 +136,29 @@ func TestDHDecrypt(t *testing.T) {
 			p.in)
 	}
 }
+func TestDHDecryptBadSecret(t *testing.T) {
+	ct := cryptTest[0].out.Value
+	for _, s := range []Secret{
+		{Parameters: iv[:15], Value: ct},
+		{Parameters: nil, Value: ct},
+		{Parameters: iv, Value: ct[:len(ct)-1]},
+		{Parameters: iv, Value: nil},
+	} {
+		if _, err := s.GetValue(cryptSession); err != BadSecret {
+			t.Errorf("GetValue(%d byte IV, %d byte value): got %v, want BadSecret", len(s.Parameters), len(s.Value), err)
+		}
+		if _, err := s.GetValueBuffer(cryptSession); err != BadSecret {
+			t.Errorf("GetValueBuffer(%d byte IV, %d byte value): got %v, want BadSecret", len(s.Parameters), len(s.Value), err)
+		}
+	}
+}
+
 func TestDialService(t *testing.T) {
 	empty := Service{}
 	s, err := DialService()
+	if errors.Is(err, ErrServiceUnavailable) {
+		t.Skip("no secret service")
+	}
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -0,0 +1,281 @@
+// +build linux
+
+package sstest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/server"
+)
+
+// Memory is a server.Backend that keeps everything in memory. It's safe for
+// concurrent use.
+type Memory struct {
+	mu          sync.Mutex
+	serial      int
+	collections map[string]*collection
+	aliases     map[string]string
+}
+
+type collection struct {
+	server.Collection
+	items map[string]*item
+}
+
+type item struct {
+	server.Item
+	secret server.Secret
+}
+
+// NewMemory returns a Memory holding an empty, unlocked "login"
+// collection, which the "default" alias points at.
+func NewMemory() *Memory {
+	now := time.Now()
+	return &Memory{
+		collections: map[string]*collection{
+			"login": {
+				Collection: server.Collection{Label: "Login", Created: now, Modified: now},
+				items:      make(map[string]*item),
+			},
+		},
+		aliases: map[string]string{"default": "login"},
+	}
+}
+
+func (m *Memory) collection(id string) (*collection, error) {
+	c, ok := m.collections[id]
+	if !ok {
+		return nil, fmt.Errorf("collection %q: %w", id, ss.NoSuchObject)
+	}
+	return c, nil
+}
+
+func (m *Memory) item(coll, id string) (*collection, *item, error) {
+	c, err := m.collection(coll)
+	if err != nil {
+		return nil, nil, err
+	}
+	i, ok := c.items[id]
+	if !ok {
+		return nil, nil, fmt.Errorf("item %q: %w", id, ss.NoSuchObject)
+	}
+	return c, i, nil
+}
+
+func sorted(m map[string]bool) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (m *Memory) Collections() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := map[string]bool{}
+	for id := range m.collections {
+		ids[id] = true
+	}
+	return sorted(ids), nil
+}
+
+func (m *Memory) Collection(id string) (server.Collection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.collection(id)
+	if err != nil {
+		return server.Collection{}, err
+	}
+	return c.Collection, nil
+}
+
+// CreateCollection makes an ID from label the way gnome-keyring does, with
+// a number added if it's taken.
+func (m *Memory) CreateCollection(label string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := []byte{}
+	for _, r := range label {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			b = append(b, byte(r))
+		default:
+			b = append(b, '_')
+		}
+	}
+	if len(b) == 0 {
+		b = []byte("collection")
+	}
+	id := string(b)
+	for n := 1; m.collections[id] != nil; n++ {
+		id = fmt.Sprintf("%s%d", b, n)
+	}
+	now := time.Now()
+	m.collections[id] = &collection{
+		Collection: server.Collection{Label: label, Created: now, Modified: now},
+		items:      make(map[string]*item),
+	}
+	return id, nil
+}
+
+func (m *Memory) SetCollectionLabel(id, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.collection(id)
+	if err != nil {
+		return err
+	}
+	c.Label = label
+	c.Modified = time.Now()
+	return nil
+}
+
+func (m *Memory) DeleteCollection(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.collection(id); err != nil {
+		return err
+	}
+	delete(m.collections, id)
+	for a, c := range m.aliases {
+		if c == id {
+			delete(m.aliases, a)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) setLocked(id string, locked bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.collection(id)
+	if err != nil {
+		return err
+	}
+	c.Locked = locked
+	return nil
+}
+
+func (m *Memory) Lock(id string) error {
+	return m.setLocked(id, true)
+}
+
+func (m *Memory) Unlock(id string) error {
+	return m.setLocked(id, false)
+}
+
+func (m *Memory) Aliases() (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make(map[string]string, len(m.aliases))
+	for k, v := range m.aliases {
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+func (m *Memory) SetAlias(name, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == "" {
+		delete(m.aliases, name)
+		return nil
+	}
+	if _, err := m.collection(id); err != nil {
+		return err
+	}
+	m.aliases[name] = id
+	return nil
+}
+
+func (m *Memory) Items(coll string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.collection(coll)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for id := range c.items {
+		ids[id] = true
+	}
+	return sorted(ids), nil
+}
+
+func (m *Memory) Item(coll, id string) (server.Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, i, err := m.item(coll, id)
+	if err != nil {
+		return server.Item{}, err
+	}
+	return i.Item, nil
+}
+
+func (m *Memory) CreateItem(coll string, i server.Item, s server.Secret) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.collection(coll)
+	if err != nil {
+		return "", err
+	}
+	m.serial++
+	id := fmt.Sprint(m.serial)
+	now := time.Now()
+	i.Created, i.Modified = now, now
+	c.items[id] = &item{Item: i, secret: s}
+	c.Modified = now
+	return id, nil
+}
+
+func (m *Memory) SetItem(coll, id string, i server.Item) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, old, err := m.item(coll, id)
+	if err != nil {
+		return err
+	}
+	i.Created, i.Modified = old.Created, time.Now()
+	old.Item = i
+	return nil
+}
+
+func (m *Memory) DeleteItem(coll, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, _, err := m.item(coll, id)
+	if err != nil {
+		return err
+	}
+	delete(c.items, id)
+	c.Modified = time.Now()
+	return nil
+}
+
+func (m *Memory) GetSecret(coll, id string) (server.Secret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, i, err := m.item(coll, id)
+	if err != nil {
+		return server.Secret{}, err
+	}
+	return i.secret, nil
+}
+
+func (m *Memory) SetSecret(coll, id string, s server.Secret) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, i, err := m.item(coll, id)
+	if err != nil {
+		return err
+	}
+	i.secret = s
+	i.Modified = time.Now()
+	return nil
+}
@@ -0,0 +1,152 @@
+// +build linux
+
+/*
+Package sstest provides an in-memory Secret Service, so code built on package
+ss can be tested without a desktop session.
+
+A Server is a server.Server backed by Memory, with prompts that can be
+scripted. It exports the service's objects on a connection it's given. It still
+needs a bus to be reachable, but any bus will do, e.g. one started by
+dbus-run-session:
+
+	conn, _ := dbus.SessionBus()
+	srv, _ := sstest.NewServer(conn)
+	defer srv.Close()
+	c, _ := srv.Client()
+	s := c.Service()
+
+Only one Server may be exported on a connection at a time.
+*/
+package sstest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+	"github.com/hdonnay/secretservice/server"
+)
+
+// The collection a new Server starts with, under the "default" alias.
+const LoginCollection = ss.CollectionPath + "/login"
+
+// PromptAction is what happens when a client runs one of the Server's
+// prompts.
+type PromptAction int
+
+const (
+	// Complete the prompt, as if the user accepted it.
+	PromptComplete PromptAction = iota
+	// Dismiss the prompt, as if the user cancelled it.
+	PromptDismiss
+	// Never complete the prompt, as if the user walked away. The client
+	// can still Dismiss it.
+	PromptHang
+)
+
+// Server is an in-memory Secret Service. Collections are locked and
+// unlocked as a whole; an item is locked when its collection is.
+//
+// The server prompts to unlock a collection and to create one.
+type Server struct {
+	*server.Server
+	Backend *Memory
+
+	mu      sync.Mutex
+	action  PromptAction
+	prompts int
+}
+
+// NewServer exports a Service on conn, with an empty, unlocked
+// LoginCollection as the "default" alias.
+func NewServer(conn *dbus.Conn) (*Server, error) {
+	s := &Server{Backend: NewMemory()}
+	srv, err := server.New(conn, s.Backend)
+	if err != nil {
+		return nil, err
+	}
+	srv.Prompter = server.PromptFunc(s.prompt)
+	s.Server = srv
+	return s, nil
+}
+
+func (s *Server) prompt(ctx context.Context, r server.PromptRequest) bool {
+	s.mu.Lock()
+	s.prompts++
+	a := s.action
+	s.mu.Unlock()
+	switch a {
+	case PromptComplete:
+		return true
+	case PromptHang:
+		<-ctx.Done()
+	}
+	return false
+}
+
+// BusName is the name clients reach the Server at: the connection's unique
+// name.
+func (s *Server) BusName() string {
+	return s.Conn().Names()[0]
+}
+
+// Client returns an ss.Client talking to the Server.
+func (s *Server) Client() (*ss.Client, error) {
+	return ss.NewClient(s.Conn(), s.BusName())
+}
+
+// SetPromptAction sets what the prompts the Server hands out do. The
+// default is PromptComplete.
+func (s *Server) SetPromptAction(a PromptAction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.action = a
+}
+
+// Prompts returns how many times a client ran one of the Server's prompts.
+func (s *Server) Prompts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prompts
+}
+
+// AddCollection adds an unlocked collection without prompting, and points
+// alias at it if alias isn't empty.
+func (s *Server) AddCollection(label, alias string) (dbus.ObjectPath, error) {
+	id, err := s.Backend.CreateCollection(label)
+	if err != nil {
+		return "", err
+	}
+	if alias != "" {
+		if err := s.Backend.SetAlias(alias, id); err != nil {
+			return "", err
+		}
+	}
+	if err := s.Notify(ss.EventCreated, id, ""); err != nil {
+		return "", err
+	}
+	return dbus.ObjectPath(ss.CollectionPath + "/" + id), nil
+}
+
+// SetLocked locks or unlocks a collection, or the collection an item is in,
+// without prompting.
+func (s *Server) SetLocked(path dbus.ObjectPath, locked bool) error {
+	rest := strings.TrimPrefix(string(path), ss.CollectionPath+"/")
+	if rest == string(path) {
+		return fmt.Errorf("sstest: no such object %s", path)
+	}
+	id := strings.Split(rest, "/")[0]
+	var err error
+	if locked {
+		err = s.Backend.Lock(id)
+	} else {
+		err = s.Backend.Unlock(id)
+	}
+	if err != nil {
+		return err
+	}
+	return s.Notify(ss.EventChanged, id, "")
+}
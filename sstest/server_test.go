@@ -0,0 +1,344 @@
+package sstest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice"
+)
+
+func newServer(t *testing.T) (*Server, ss.Service) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		t.Skip("no session bus")
+	}
+	srv, err := NewServer(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := srv.Client()
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return srv, c.Service()
+}
+
+func TestWorkflow(t *testing.T) {
+	for _, algo := range []string{ss.AlgoPlain, ss.AlgoDH} {
+		t.Run(algo, func(t *testing.T) {
+			srv, s := newServer(t)
+			defer srv.Close()
+
+			ses, err := s.OpenSession(algo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sec, err := ses.NewSecret()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sec.SetValue(ses, []byte("hunter2")); err != nil {
+				t.Fatal(err)
+			}
+			c, err := s.ReadAlias("default")
+			if err != nil {
+				t.Fatal(err)
+			}
+			attrs := map[string]string{"user": "alice"}
+			i, err := c.CreateItem("test", attrs, sec, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Replacing has to keep the item.
+			if again, err := c.CreateItem("test", attrs, sec, true); err != nil || again.Path() != i.Path() {
+				t.Errorf("replace: got %v, %v; want %s", again.Path(), err, i.Path())
+			}
+
+			unlocked, locked, err := s.SearchItems(attrs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(unlocked) != 1 || len(locked) != 0 || unlocked[0].Path() != i.Path() {
+				t.Fatalf("SearchItems: got %v, %v", unlocked, locked)
+			}
+			got, err := i.GetSecret(ses)
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := got.GetValue(ses)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(v) != "hunter2" {
+				t.Errorf("got secret %q", v)
+			}
+			if l, err := i.GetLabel(); err != nil || l != "test" {
+				t.Errorf("GetLabel: got %q, %v", l, err)
+			}
+
+			if err := ses.CloseContext(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if n := srv.Sessions(); n != 0 {
+				t.Errorf("%d sessions still open", n)
+			}
+			if err := i.Delete(); err != nil {
+				t.Fatal(err)
+			}
+			if items, err := c.Items(); err != nil || len(items) != 0 {
+				t.Errorf("Items after Delete: got %v, %v", items, err)
+			}
+		})
+	}
+}
+
+func TestContentType(t *testing.T) {
+	srv, s := newServer(t)
+	defer srv.Close()
+	ses, err := s.OpenSession(ss.AlgoDH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ses.Close()
+	sec, err := ses.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sec.SetJSON(ses, map[string]string{"token": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	c := s.Client().Collection(LoginCollection)
+	i, err := c.CreateItem("token", map[string]string{"k": "v"}, sec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := i.GetSecret(ses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]string
+	if err := got.GetJSON(ses, &v); err != nil || v["token"] != "abc" {
+		t.Errorf("got %q: %v, %v", got.ContentType, v, err)
+	}
+}
+
+func TestNegotiateSession(t *testing.T) {
+	srv, s := newServer(t)
+	defer srv.Close()
+	s.Client().SessionPolicy = ss.ForbidPlain
+	ses, err := s.NegotiateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ses.Close()
+	if ses.Algorithm != ss.AlgoDH {
+		t.Errorf("negotiated %q, want %q", ses.Algorithm, ss.AlgoDH)
+	}
+}
+
+func TestUnsupportedAlgorithm(t *testing.T) {
+	srv, s := newServer(t)
+	defer srv.Close()
+	var out dbus.Variant
+	var path dbus.ObjectPath
+	err := s.Call("org.freedesktop.Secret.Service.OpenSession", 0, "rot13", dbus.MakeVariant("")).Store(&out, &path)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	srv, s := newServer(t)
+	defer srv.Close()
+	if err := srv.SetLocked(LoginCollection, true); err != nil {
+		t.Fatal(err)
+	}
+	login := s.Client().Collection(LoginCollection)
+
+	srv.SetPromptAction(PromptDismiss)
+	if _, err := s.Unlock([]ss.Object{login}); err != ss.PromptDismissed {
+		t.Errorf("dismiss: got %v", err)
+	}
+
+	srv.SetPromptAction(PromptHang)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := s.UnlockContext(ctx, []ss.Object{login}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hang: got %v", err)
+	}
+
+	srv.SetPromptAction(PromptComplete)
+	done, err := s.Unlock([]ss.Object{login})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Path() != LoginCollection {
+		t.Errorf("complete: got %v", done)
+	}
+	if locked, err := login.Locked(); err != nil || locked {
+		t.Errorf("Locked: got %v, %v", locked, err)
+	}
+	if n := srv.Prompts(); n != 3 {
+		t.Errorf("got %d prompts, want 3", n)
+	}
+
+	c, err := s.CreateCollection("Other", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.ReadAlias("other"); err != nil || got.Path() != c.Path() {
+		t.Errorf("ReadAlias: got %v, %v; want %s", got.Path(), err, c.Path())
+	}
+}
+
+func TestLocked(t *testing.T) {
+	srv, s := newServer(t)
+	defer srv.Close()
+	ses, err := s.OpenSession(ss.AlgoPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ses.Close()
+	c := s.Client().Collection(LoginCollection)
+	sec, err := ses.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := c.CreateItem("test", map[string]string{"k": "v"}, sec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Lock([]ss.Object{c}); err != nil {
+		t.Fatal(err)
+	}
+	_, locked, err := s.SearchItems(map[string]string{"k": "v"})
+	if err != nil || len(locked) != 1 {
+		t.Errorf("SearchItems: got %v, %v", locked, err)
+	}
+	if _, err := i.GetSecret(ses); err == nil {
+		t.Error("GetSecret: expected an error from a locked item")
+	}
+}
+
+func privateConn(t *testing.T) *dbus.Conn {
+	conn, err := dbus.SessionBusPrivate()
+	if err != nil {
+		t.Skip("no session bus")
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// serve runs a Server owning name on a connection of its own, so it can be
+// taken down like a daemon exiting.
+func serve(t *testing.T, name string) (*Server, *dbus.Conn) {
+	conn := privateConn(t)
+	srv, err := NewServer(conn)
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	if r, err := conn.RequestName(name, dbus.NameFlagDoNotQueue); err != nil || r != dbus.RequestNameReplyPrimaryOwner {
+		conn.Close()
+		t.Fatalf("RequestName: %v, %v", r, err)
+	}
+	return srv, conn
+}
+
+func TestSessionManager(t *testing.T) {
+	const name = "org.example.sstest.restart"
+	srv, conn := serve(t, name)
+	c, err := ss.NewClient(privateConn(t), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Conn().Close()
+	m, err := ss.NewSessionManager(c.Service())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if m.Owner() != conn.Names()[0] {
+		t.Errorf("owner %q, want %q", m.Owner(), conn.Names()[0])
+	}
+	old, err := m.Session()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := m.Session(); again.Path() != old.Path() || srv.Sessions() != 1 {
+		t.Errorf("got session %s, want %s kept", again.Path(), old.Path())
+	}
+
+	// The daemon exits...
+	invalidated := m.Invalidated()
+	srv.Close()
+	conn.Close()
+	select {
+	case <-invalidated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not invalidated")
+	}
+	// The manager's key is wiped, but not the copy handed out.
+	if len(old.Key) == 0 || bytes.Equal(old.Key, make([]byte, len(old.Key))) {
+		t.Error("caller's key wiped")
+	}
+	if _, err := m.Session(); !errors.Is(err, ss.ServiceUnknown) {
+		t.Errorf("with no service: got %v, want ServiceUnknown", err)
+	}
+
+	// ...and comes back.
+	invalidated = m.Invalidated()
+	srv, conn = serve(t, name)
+	defer conn.Close()
+	defer srv.Close()
+	select {
+	case <-invalidated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not invalidated")
+	}
+	ses, err := m.Session()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ses.Path() == old.Path() || ses.Algorithm != ss.AlgoDH || srv.Sessions() != 1 {
+		t.Errorf("got %s session %s, %d open", ses.Algorithm, ses.Path(), srv.Sessions())
+	}
+	sec, err := ses.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sec.SetValue(ses, []byte("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Collection(LoginCollection).CreateItem("x", map[string]string{"a": "b"}, sec, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSessionManagerNoOwner(t *testing.T) {
+	c, err := ss.NewClient(privateConn(t), "org.example.sstest.nobody")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Conn().Close()
+	m, err := ss.NewSessionManager(c.Service())
+	if err != nil {
+		t.Fatalf("unowned name: %v", err)
+	}
+	defer m.Close()
+	if m.Owner() != "" {
+		t.Errorf("owner %q, want none", m.Owner())
+	}
+}
@@ -2,47 +2,177 @@
 
 package ss
 
-import dbus "github.com/guelfey/go.dbus"
+import (
+	"context"
+	"strings"
+	"time"
+
+	dbus "github.com/guelfey/go.dbus"
+)
 
 var (
 	noPrompt = dbus.ObjectPath("/")
 )
 
-func checkPrompt(promptPath dbus.ObjectPath) (dbus.Variant, error) {
+const (
+	// How long a prompt may stay up by default.
+	promptTimeout = time.Minute
+	// How long to wait on Dismiss for a prompt the caller gave up on.
+	dismissTimeout = 5 * time.Second
+)
+
+// call invokes method on o, giving up once ctx is done. The reply to an
+// abandoned call is discarded when it arrives.
+//
+// Errors from the service come back as an *Error; ctx's are left alone.
+func call(ctx context.Context, o *dbus.Object, method string, args ...interface{}) *dbus.Call {
+	c := o.Go(method, 0, make(chan *dbus.Call, 1), args...)
+	select {
+	case <-c.Done:
+		if c.Err != nil {
+			c.Err = wrapError(o.Path(), c.Err)
+		}
+		return c
+	case <-ctx.Done():
+		return &dbus.Call{
+			Destination: o.Destination(),
+			Path:        o.Path(),
+			Method:      method,
+			Args:        args,
+			Err:         ctx.Err(),
+		}
+	}
+}
+
+func (c *Client) checkPrompt(ctx context.Context, promptPath dbus.ObjectPath) (dbus.Variant, error) {
 	// if we don't need to prompt, just return.
-	empty := dbus.Variant{}
 	if promptPath == noPrompt {
-		return empty, nil
+		return dbus.Variant{}, nil
 	}
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		return empty, err
+	p := c.Prompter
+	if p == nil {
+		p = AlwaysPrompt{}
 	}
-	pr := Prompt{conn.Object(ServiceName, promptPath)}
-	return pr.Prompt("secretservice.go")
+	return p.Prompt(ctx, c.prompt(promptPath))
 }
 
-func simpleCall(path dbus.ObjectPath, method string, args ...interface{}) error {
-	var call *dbus.Call
+// simpleCall is for methods that return nothing but, possibly, a prompt.
+func (c *Client) simpleCall(ctx context.Context, o *dbus.Object, method string, args ...interface{}) error {
 	var promptPath dbus.ObjectPath
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		return err
+	res := call(ctx, o, method, args...)
+	if res.Err != nil {
+		return res.Err
 	}
-	obj := conn.Object(ServiceName, path)
-	if args == nil {
-		call = obj.Call(method, 0)
-	} else {
-		call = obj.Call(method, 0, args...)
+	if len(res.Body) == 0 {
+		return nil
 	}
-	if call.Err != nil {
-		return call.Err
+	if err := res.Store(&promptPath); err != nil {
+		return err
 	}
-	call.Store(&promptPath)
-	_, err = checkPrompt(promptPath)
+	_, err := c.checkPrompt(ctx, promptPath)
 	return err
 }
 
+// storeProperty reads the named property of o into dest.
+func storeProperty(ctx context.Context, o *dbus.Object, name string, dest interface{}) error {
+	var v dbus.Variant
+	iface, prop := splitProperty(name)
+	c := call(ctx, o, getProp, iface, prop)
+	switch {
+	case c.Err == nil:
+	case c.Err == ctx.Err():
+		return c.Err
+	default:
+		return wrapPropertyError(o.Path(), c.Err)
+	}
+	if err := c.Store(&v); err != nil {
+		return err
+	}
+	return dbus.Store([]interface{}{v.Value()}, dest)
+}
+
+// storeSecrets reads the Dict<ObjectPath,Secret> GetSecrets returns. The
+// Secret structs arrive as []interface{}, and dbus.Store won't convert them
+// inside a map.
+func storeSecrets(c *dbus.Call) (map[dbus.ObjectPath]Secret, error) {
+	var raw map[dbus.ObjectPath][]interface{}
+	if err := c.Store(&raw); err != nil {
+		return map[dbus.ObjectPath]Secret{}, err
+	}
+	ret := make(map[dbus.ObjectPath]Secret, len(raw))
+	for p, v := range raw {
+		var s Secret
+		if err := dbus.Store([]interface{}{v}, &s); err != nil {
+			return map[dbus.ObjectPath]Secret{}, err
+		}
+		ret[p] = s
+	}
+	return ret, nil
+}
+
+// setProperty sets the named property of o to value.
+func setProperty(ctx context.Context, o *dbus.Object, name string, value interface{}) error {
+	iface, prop := splitProperty(name)
+	return call(ctx, o, setProp, iface, prop, dbus.MakeVariant(value)).Err
+}
+
+// Property names are kept fully-qualified, the way GetProperty takes them.
+func splitProperty(name string) (iface, prop string) {
+	i := strings.LastIndex(name, ".")
+	return name[:i], name[i+1:]
+}
+
+func itemObjects(items []Item) []Object {
+	o := make([]Object, len(items))
+	for i, item := range items {
+		o[i] = item
+	}
+	return o
+}
+
+func objectPaths(o []Object) []dbus.ObjectPath {
+	paths := make([]dbus.ObjectPath, len(o))
+	for i, obj := range o {
+		paths[i] = obj.Path()
+	}
+	return paths
+}
+
+// resolveObjects maps the paths returned by the service back onto the objects
+// that were passed in, so callers get back the same Collection and Item
+// values. Paths the caller didn't pass are typed by their shape.
+func resolveObjects(c *Client, in []Object, paths []dbus.ObjectPath) []Object {
+	out := make([]Object, 0, len(paths))
+	for _, p := range paths {
+		out = append(out, resolveObject(c, in, p))
+	}
+	return out
+}
+
+func resolveObject(c *Client, in []Object, p dbus.ObjectPath) Object {
+	for _, o := range in {
+		if o.Path() == p {
+			return o
+		}
+	}
+	if isItemPath(p) {
+		return c.Item(p)
+	}
+	return c.Collection(p)
+}
+
+// Items live directly under their collection, e.g.
+// /org/freedesktop/secrets/collection/login/1, or under one of its aliases,
+// e.g. /org/freedesktop/secrets/aliases/default/1.
+func isItemPath(p dbus.ObjectPath) bool {
+	for _, prefix := range []string{CollectionPath + "/", ServicePath + "/aliases/"} {
+		if rest := strings.TrimPrefix(string(p), prefix); rest != string(p) {
+			return strings.Contains(rest, "/")
+		}
+	}
+	return false
+}
+
 //// Introspect the object and return it casted to the proper interface
 //func Coerce(o Object) (interface{}, error) {
 //	return nil, nil
@@ -1,41 +1,172 @@
 package ss
 
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
 const fake = "/fake/prompt"
 
-type _FakePrompt struct{}
+// _FakePrompt completes with result, or is dismissed, as soon as it's shown.
+type _FakePrompt struct {
+	conn    *dbus.Conn
+	path    dbus.ObjectPath
+	result  string
+	dismiss bool
+	// The window id the prompt was last shown with.
+	window chan string
+}
 
-func (f *_FakePrompt) Prompt(window_id string) {
-	return
+func (f *_FakePrompt) Prompt(window_id string) *dbus.Error {
+	if f.window != nil {
+		f.window <- window_id
+	}
+	go f.conn.Emit(f.path, _PromptCompleted, f.dismiss, dbus.MakeVariant(f.result))
+	return nil
 }
-func (f *_FakePrompt) Dismiss() {
-	return
+func (f *_FakePrompt) Dismiss() *dbus.Error {
+	go f.conn.Emit(f.path, _PromptCompleted, true, dbus.MakeVariant(""))
+	return nil
 }
 
-/*
-func TestCheckPrompt(t *testing.T) {
-	var err error
-	conn, err := dbus.SessionBus()
+// selfClient returns a Client that calls objects exported on conn itself.
+func selfClient(t *testing.T) *Client {
+	conn := getConn()
+	if conn == nil {
+		t.Skip("no session bus")
+	}
+	c, err := NewClient(conn, conn.Names()[0])
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = conn.Export(_FakePrompt{}, dbus.ObjectPath(fake), _Prompt)
-	if err != nil {
+	return c
+}
+
+func exportPrompt(t *testing.T, f *_FakePrompt) {
+	if err := f.conn.Export(f, f.path, _Prompt); err != nil {
 		t.Fatal(err)
 	}
+}
 
-	err = checkPrompt(dbus.ObjectPath("/"))
-	if err != nil {
+func TestCheckPrompt(t *testing.T) {
+	c := selfClient(t)
+	ctx := context.Background()
+	if _, err := c.checkPrompt(ctx, dbus.ObjectPath("/")); err != nil {
 		t.Error(err)
 	}
-	err = checkPrompt(dbus.ObjectPath(fake))
+
+	f := &_FakePrompt{conn: c.conn, path: fake, result: "done"}
+	exportPrompt(t, f)
+	defer c.conn.Export(nil, fake, _Prompt)
+	v, err := c.checkPrompt(ctx, fake)
 	if err != nil {
-		// claims the interface is wrong...
-		t.Log(err)
+		t.Fatal(err)
+	}
+	if v.Value() != "done" {
+		t.Errorf("got %v, want %q", v.Value(), "done")
 	}
 
-	err = conn.Export(nil, dbus.ObjectPath(fake), _Prompt)
+	f.dismiss = true
+	if _, err := c.checkPrompt(ctx, fake); err != PromptDismissed {
+		t.Errorf("got %v, want %v", err, PromptDismissed)
+	}
+}
+
+func TestConcurrentPrompts(t *testing.T) {
+	c := selfClient(t)
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		f := &_FakePrompt{
+			conn:   c.conn,
+			path:   dbus.ObjectPath(fmt.Sprintf("%s/%d", fake, i)),
+			result: fmt.Sprint(i),
+		}
+		exportPrompt(t, f)
+		defer c.conn.Export(nil, f.path, _Prompt)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.prompt(f.path).PromptContext(context.Background(), "")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if v.Value() != f.result {
+				t.Errorf("%s: got %v, want %q", f.path, v.Value(), f.result)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestResolveObjects(t *testing.T) {
+	conn := getConn()
+	if conn == nil {
+		t.Skip("no session bus")
+	}
+	cl, err := NewClient(conn, ServiceName)
 	if err != nil {
 		t.Fatal(err)
 	}
+	c := cl.Collection(DefaultCollection)
+	in := []Object{c}
+	paths := []dbus.ObjectPath{
+		DefaultCollection,
+		"/org/freedesktop/secrets/collection/login",
+		"/org/freedesktop/secrets/collection/login/7",
+		"/org/freedesktop/secrets/aliases/default",
+		"/org/freedesktop/secrets/aliases/default/7",
+	}
+	out := resolveObjects(cl, in, paths)
+	if len(out) != len(paths) {
+		t.Fatalf("got %d objects, want %d", len(out), len(paths))
+	}
+	if out[0] != c {
+		t.Error("passed Collection not returned as-is")
+	}
+	for _, n := range []int{1, 3} {
+		if _, ok := out[n].(Collection); !ok {
+			t.Errorf("%s resolved to %T, not Collection", paths[n], out[n])
+		}
+	}
+	for _, n := range []int{2, 4} {
+		if _, ok := out[n].(Item); !ok {
+			t.Errorf("%s resolved to %T, not Item", paths[n], out[n])
+		}
+	}
+}
+
+type hangObject chan struct{}
+
+func (h hangObject) Hang() *dbus.Error {
+	<-h
+	return nil
+}
+
+func TestCallContext(t *testing.T) {
+	conn := getConn()
+	if conn == nil {
+		t.Skip("no session bus")
+	}
+	const path = dbus.ObjectPath("/test/hang")
+	h := make(hangObject)
+	defer close(h)
+	if err := conn.Export(h, path, "test.Hang"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Export(nil, path, "test.Hang")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	obj := conn.Object(conn.Names()[0], path)
+	c := call(ctx, obj, "test.Hang.Hang")
+	if c.Err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want %v", c.Err, context.DeadlineExceeded)
+	}
 }
-*/
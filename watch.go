@@ -0,0 +1,141 @@
+// +build linux
+
+package ss
+
+import (
+	"context"
+
+	dbus "github.com/guelfey/go.dbus"
+	"github.com/hdonnay/secretservice/internal/bus"
+)
+
+// EventType says what happened to the object named in an event.
+type EventType int
+
+const (
+	EventCreated EventType = iota
+	EventDeleted
+	EventChanged
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "created"
+	case EventDeleted:
+		return "deleted"
+	case EventChanged:
+		return "changed"
+	}
+	return "unknown"
+}
+
+// CollectionEvent reports a change to one of the service's Collections.
+type CollectionEvent struct {
+	Type       EventType
+	Collection Collection
+}
+
+// ItemEvent reports a change to one of a Collection's Items.
+type ItemEvent struct {
+	Type EventType
+	Item Item
+}
+
+// Watch reports Collections being created, deleted or changed until ctx is
+// done, at which point the channel is closed. The channel is also closed if
+// the connection goes away.
+func (s Service) Watch(ctx context.Context) (<-chan CollectionEvent, error) {
+	// signal: CollectionCreated(OUT ObjectPath collection);
+	// signal: CollectionDeleted(OUT ObjectPath collection);
+	// signal: CollectionChanged(OUT ObjectPath collection);
+	out := make(chan CollectionEvent)
+	err := s.client.watch(ctx, bus.Match{Path: s.Path(), Iface: _Service}, map[string]EventType{
+		_ServiceCollectionCreated: EventCreated,
+		_ServiceCollectionDeleted: EventDeleted,
+		_ServiceCollectionChanged: EventChanged,
+	}, func(t EventType, p dbus.ObjectPath) bool {
+		select {
+		case out <- CollectionEvent{t, s.client.Collection(p)}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}, func() { close(out) })
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Watch reports Items in c being created, deleted or changed until ctx is
+// done, at which point the channel is closed. The channel is also closed if
+// the connection goes away.
+//
+// Signals are sent from the collection's real path, so c must not be an
+// alias like /org/freedesktop/secrets/aliases/default.
+func (c Collection) Watch(ctx context.Context) (<-chan ItemEvent, error) {
+	// signal: ItemCreated(OUT ObjectPath item);
+	// signal: ItemDeleted(OUT ObjectPath item);
+	// signal: ItemChanged(OUT ObjectPath item);
+	out := make(chan ItemEvent)
+	err := c.client.watch(ctx, bus.Match{Path: c.Path(), Iface: _Collection}, map[string]EventType{
+		_CollectionItemCreated: EventCreated,
+		_CollectionItemDeleted: EventDeleted,
+		_CollectionItemChanged: EventChanged,
+	}, func(t EventType, p dbus.ObjectPath) bool {
+		select {
+		case out <- ItemEvent{t, c.client.Item(p)}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}, func() { close(out) })
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// watch subscribes to m and, until ctx is done or the connection goes away,
+// hands send the type and path of every signal named in events. It stops
+// early if send returns false, and calls done once it's stopped.
+func (c *Client) watch(ctx context.Context, m bus.Match, events map[string]EventType, send func(EventType, dbus.ObjectPath) bool, done func()) error {
+	sub, err := c.subscribe(m)
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer done()
+		defer sub.Cancel()
+		for {
+			select {
+			case sig, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				t, ok := events[sig.Name]
+				if !ok {
+					continue
+				}
+				p, ok := signalPath(sig)
+				if !ok {
+					continue
+				}
+				if !send(t, p) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// All the change signals carry just the path of the object concerned.
+func signalPath(sig *dbus.Signal) (dbus.ObjectPath, bool) {
+	var p dbus.ObjectPath
+	err := dbus.Store(sig.Body, &p)
+	return p, err == nil
+}
@@ -0,0 +1,48 @@
+package ss
+
+import (
+	"context"
+	"testing"
+
+	dbus "github.com/guelfey/go.dbus"
+)
+
+func TestServiceWatch(t *testing.T) {
+	c := selfClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	ev, err := c.Service().Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const coll = dbus.ObjectPath(CollectionPath + "/watched")
+	c.conn.Emit(ServicePath, _ServiceCollectionCreated, coll)
+	c.conn.Emit(ServicePath, _ServiceCollectionDeleted, coll)
+	for _, want := range []EventType{EventCreated, EventDeleted} {
+		e := <-ev
+		if e.Type != want || e.Collection.Path() != coll {
+			t.Errorf("got %v %s, want %v %s", e.Type, e.Collection.Path(), want, coll)
+		}
+	}
+	cancel()
+	for range ev {
+	}
+}
+
+func TestCollectionWatch(t *testing.T) {
+	c := selfClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watched := c.Collection(CollectionPath + "/watched")
+	ev, err := watched.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const item = dbus.ObjectPath(CollectionPath + "/watched/1")
+	// Signals from other collections must not show up.
+	c.conn.Emit(CollectionPath+"/other", _CollectionItemCreated, dbus.ObjectPath(CollectionPath+"/other/1"))
+	c.conn.Emit(watched.Path(), _CollectionItemChanged, item)
+	e := <-ev
+	if e.Type != EventChanged || e.Item.Path() != item {
+		t.Errorf("got %v %s, want %v %s", e.Type, e.Item.Path(), EventChanged, item)
+	}
+}